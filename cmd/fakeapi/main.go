@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"../../fakeapi"
+)
+
+func main() {
+	address := flag.String("address", ":8081", "address to listen on")
+	fixtures := flag.String("fixtures", "fakeapi/fixtures", "fixtures directory")
+	keys := flag.String("keys", "", "comma separated list of accepted API keys, any key is accepted when empty")
+	quota := flag.Int("quota", 0, "requests allowed per key within the quota period, unlimited when zero")
+	quotaPeriod := flag.Duration("quota-period", time.Hour, "quota period")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	flag.Parse()
+
+	options := fakeapi.Options{
+		Quota:       *quota,
+		QuotaPeriod: *quotaPeriod,
+		Latency:     *latency,
+	}
+	if *keys != "" {
+		options.Keys = strings.Split(*keys, ",")
+	}
+	log.Println("fake Elsevier API listening on " + *address)
+	log.Fatal(http.ListenAndServe(*address, fakeapi.New(*fixtures, options)))
+}
@@ -0,0 +1,57 @@
+// Command migrate moves the schema of the database set up in the
+// configuration to the latest or the given version. Run it with the crawler
+// stopped, the crawler itself migrates to the latest version on start.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"../../config"
+	"../../storage"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "configuration file")
+	version := flag.Int("to", -1, "schema version to migrate to, the latest when negative")
+	status := flag.Bool("status", false, "only show the schema version and the migrations")
+	flag.Parse()
+
+	conf, err := config.ReadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	Storage, err := storage.NewStorage(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sqlStorage, ok := Storage.(*storage.MySqlStorage)
+	if !ok {
+		log.Fatal("the memory storage has no schema to migrate")
+	}
+	err = sqlStorage.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !*status {
+		if *version < 0 {
+			*version = storage.LatestSchemaVersion()
+		}
+		err = sqlStorage.Migrate(*version)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	current, err := sqlStorage.SchemaVersion()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, migration := range storage.Migrations {
+		applied := " "
+		if migration.Version <= current {
+			applied = "*"
+		}
+		fmt.Printf("%s %d %s\n", applied, migration.Version, migration.Name)
+	}
+}
@@ -7,19 +7,35 @@ import (
 )
 
 type Configuration struct {
-	keys            []string
-	ListenPort      string
-	LogPath         string
-	MaxSearchPages  int
-	ResultsPerPage  int
-	ReferencesDepth int
-	RequestTimeout  int
-	WorkersNumber   int
-	Proxy           string
-	Mysqluser       string
-	Mysqlpass       string
-	Mysqladdress    string
-	Mysqldbname     string
+	ListenPort       string
+	LogPath          string
+	MaxSearchPages   int
+	ResultsPerPage   int
+	ReferencesDepth  int
+	CitedByDepth     int
+	CrawlAuthors     bool
+	WorkersNumber    int
+	TaskLeaseTimeout int
+	CacheTTL         int
+	MaxRetries       *int
+	RetryBaseDelay   float64
+	BatchSize        int
+	BatchInterval    float64
+	FixturesMode     string
+	FixturesPath     string
+	Proxy            string
+	ApiURL           string
+	DatabaseType     string
+	SqlitePath       string
+	Mysqluser        string
+	Mysqlpass        string
+	Mysqladdress     string
+	Mysqldbname      string
+	Postgresuser     string
+	Postgrespass     string
+	Postgresaddress  string
+	Postgresdbname   string
+	Postgressslmode  string
 }
 
 var (
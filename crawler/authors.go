@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"strings"
+
+	"../models"
+	"../query"
+	"github.com/tidwall/gjson"
+)
+
+// proceedAuthor fetches and stores the author profile. With the publications
+// field set to true the articles of the author are searched as well.
+func (worker *Worker) proceedAuthor(work SearchRequest) error {
+	source, err := worker.extractSource("author")
+	if err != nil {
+		return err
+	}
+	data, err := query.MakeQuery(source.Path, work.ID, map[string]string{}, worker.Storage, worker.Config,
+		work.BypassCache)
+	if err != nil {
+		return err
+	}
+	author := ExtractAuthorProfile(data)
+	author.ScopusID = work.ID
+	worker.enqueueAffiliations(work, author.AffiliationHistory)
+	err = worker.Storage.CreateAuthorProfile(author)
+	if err != nil {
+		return err
+	}
+	if work.Fields["publications"] == "true" {
+		documentsSource, err := worker.extractSource("authorDocuments")
+		if err != nil {
+			return err
+		}
+		worker.enqueue(SearchRequest{SourceName: "authorDocuments", Source: documentsSource, ID: work.ID,
+			JobID: work.JobID, BypassCache: work.BypassCache})
+	}
+	return nil
+}
+
+// proceedAuthorDocuments searches the articles of the author page by page
+func (worker *Worker) proceedAuthorDocuments(work SearchRequest) error {
+	data, articles, err := worker.searchArticles(&work, "AU-ID("+work.ID+")")
+	if err != nil {
+		return err
+	}
+	articleDs, err := worker.extractSource("article")
+	if err != nil {
+		return err
+	}
+	found := 0
+	for _, article := range articles {
+		if article.ScopusID == "" {
+			continue
+		}
+		found++
+		worker.enqueueArticle(SearchRequest{SourceName: "article", Source: articleDs, ID: article.ScopusID,
+			JobID: work.JobID, BypassCache: work.BypassCache})
+	}
+	worker.enqueueNextPage(work, data, found)
+	return nil
+}
+
+// searchArticles fetches a page of the search over the data source of the
+// request. Sources with the cursor paging start from the first cursor.
+func (worker *Worker) searchArticles(work *SearchRequest, queryText string) (string, []models.Article, error) {
+	source, err := worker.extractSource(work.SourceName)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, ok := work.Fields["cursor"]; !ok && source.Paging == CursorPaging {
+		work.Fields = withField(work.Fields, "cursor", "*")
+	}
+	params := withField(work.Fields, "query", queryText)
+	data, err := query.MakeQuery(source.Path, "", params, worker.Storage, worker.Config, work.BypassCache)
+	if err != nil {
+		return "", nil, err
+	}
+	articles, err := worker.ExtractArticles(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return data, articles, nil
+}
+
+// ExtractAuthorProfile reads the response of the Author Retrieval API
+func ExtractAuthorProfile(data string) models.Author {
+	author := models.Author{}
+	response := gjson.Get(data, "author-retrieval-response")
+	if response.IsArray() {
+		response = response.Get("0")
+	}
+	coredata := response.Get("coredata")
+	author.ScopusID = strings.Replace(coredata.Get("dc:identifier").String(), "AUTHOR_ID:", "", 1)
+	author.DocumentCount = int(coredata.Get("document-count").Int())
+	author.CitedByCount = int(coredata.Get("cited-by-count").Int())
+	author.CitationCount = int(coredata.Get("citation-count").Int())
+	author.Orcid = coredata.Get("orcid").String()
+	author.HIndex = int(response.Get("h-index").Int())
+	profile := response.Get("author-profile")
+	preferred := profile.Get("preferred-name")
+	author.Initials = preferred.Get("initials").String()
+	author.IndexedName = preferred.Get("indexed-name").String()
+	author.Surname = preferred.Get("surname").String()
+	author.Name = preferred.Get("given-name").String()
+	for _, variant := range profile.Get("name-variant").Array() {
+		name := variant.Get("indexed-name").String()
+		if name != "" {
+			author.NameVariants = append(author.NameVariants, name)
+		}
+	}
+	areas := models.Article{}
+	ExtractSubjectArea(response, &areas)
+	author.SubjectAreas = areas.SubjectAreas
+	for _, affiliation := range profile.Get("affiliation-history.affiliation").Array() {
+		id := affiliation.Get("@affiliation-id").String()
+		if id != "" {
+			author.AffiliationHistory = append(author.AffiliationHistory, id)
+		}
+	}
+	current := profile.Get("affiliation-current.affiliation.@affiliation-id").String()
+	if current != "" {
+		author.AffiliationID = []string{current}
+	}
+	return author
+}
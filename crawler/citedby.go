@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"strconv"
+)
+
+// citedByDepthField is kept in the fields of the articles found by the cited-by
+// searches, article requests do not pass their fields to the data source
+const citedByDepthField = "citedByDepth"
+
+// citedByDepth is the distance from the seed article the request article cites
+func citedByDepth(work SearchRequest) int {
+	depth, err := strconv.Atoi(work.Fields[citedByDepthField])
+	if err != nil {
+		return 0
+	}
+	return depth
+}
+
+// proceedCitedBy searches the articles citing work.ID page by page. They are
+// linked to the cited article and queued with the cited-by depth work.Depth+1.
+func (worker *Worker) proceedCitedBy(work SearchRequest) error {
+	data, articles, err := worker.searchArticles(&work, "REFEID(2-s2.0-"+work.ID+")")
+	if err != nil {
+		return err
+	}
+	articleDs, err := worker.extractSource("article")
+	if err != nil {
+		return err
+	}
+	found := 0
+	for _, article := range articles {
+		if article.ScopusID == "" {
+			continue
+		}
+		found++
+		if article.ScopusID == work.ID {
+			continue
+		}
+		err = worker.Storage.CreateArticleReference(article.ScopusID, work.ID)
+		if err != nil {
+			worker.reportError(work.JobID, err)
+		}
+		worker.enqueueArticle(SearchRequest{SourceName: "article", Source: articleDs, ID: article.ScopusID,
+			Fields: map[string]string{citedByDepthField: strconv.Itoa(work.Depth + 1)}, JobID: work.JobID,
+			BypassCache: work.BypassCache})
+	}
+	worker.enqueueNextPage(work, data, found)
+	return nil
+}
@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"../config"
+	"../fakeapi"
+	"../keys"
+	"../models"
+	"../query"
+	"../storage"
+)
+
+// testDataSources reads the data sources of the repository pointed to the fake API
+func testDataSources(t *testing.T, apiURL string) []DataSource {
+	ds, err := (&Manager{}).readDataSources("../data-sources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ds {
+		ds[i].Path = overrideHost(ds[i].Path, apiURL)
+	}
+	return ds
+}
+
+// TestCrawl runs a search job through the manager and a worker against the
+// fake API and checks what ends up in the memory storage
+func TestCrawl(t *testing.T) {
+	server := fakeapi.Start("../fakeapi/fixtures", fakeapi.Options{})
+	defer server.Close()
+	query.Keys = keys.NewPool([]string{"test-key"})
+
+	st := storage.NewMemoryStorage()
+	ds := testDataSources(t, server.URL)
+	manager := Manager{Storage: st, DataSources: ds}
+	worker := Worker{
+		ID:          "test",
+		Config:      config.Configuration{ResultsPerPage: 25, ReferencesDepth: 1},
+		Storage:     st,
+		DataSources: ds,
+	}
+
+	job, err := manager.StartCrawling(SearchRequest{SourceName: "search",
+		Fields: map[string]string{"query": "TITLE(crawling)", "date": "2016"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.PendingTasks != 1 {
+		t.Errorf("%d pending tasks of the new job", job.PendingTasks)
+	}
+	for tasks := 0; ; tasks++ {
+		if tasks > 100 {
+			t.Fatal("the queue is not drained")
+		}
+		err = worker.runTask(time.Minute)
+		if err == storage.ErrNotFound {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job, err = st.GetJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != models.JobDone || job.PendingTasks != 0 || job.Errors != 0 {
+		t.Errorf("job %+v", job)
+	}
+	// the references of the first article are the other two, they are fetched once
+	if job.PagesPlanned != 1 || job.ArticlesFetched != 3 || job.ArticlesStored != 3 {
+		t.Errorf("job counters %+v", job.JobProgress)
+	}
+
+	article, err := st.GetArticle("85000000001", storage.LoadAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "Crawling citation graphs at scale" || article.CitationsCount != 12 ||
+		article.Abstracts != "Abstract of crawling citation graphs at scale." {
+		t.Errorf("article %+v", article)
+	}
+	if len(article.Authors) != 2 || article.Authors[0].Surname != "Ivanov" || article.Authors[1].Surname != "Petrova" {
+		t.Fatalf("authors %+v", article.Authors)
+	}
+	if len(article.Authors[1].AffiliationID) != 2 {
+		t.Errorf("affiliations of the second author %v", article.Authors[1].AffiliationID)
+	}
+	if len(article.Keywords) != 2 || len(article.SubjectAreas) != 1 || article.SubjectAreas[0].Title != "COMP" {
+		t.Errorf("keywords %+v, subject areas %+v", article.Keywords, article.SubjectAreas)
+	}
+	if len(article.References) != 2 || article.References[0].Title != "Incremental indexing of bibliographic databases" ||
+		article.References[1].Title != "A survey of scholarly data sources" {
+		t.Errorf("references %+v", article.References)
+	}
+	if len(article.Affiliations) != 1 || article.Affiliations[0].PostalCode != "197101" {
+		t.Errorf("affiliations %+v", article.Affiliations)
+	}
+	retrieved, err := st.CheckAffiliation("60000002")
+	if err != nil || !retrieved {
+		t.Errorf("affiliation 60000002 is not retrieved: %v", err)
+	}
+}
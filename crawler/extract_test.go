@@ -0,0 +1,217 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"../config"
+	"../fakeapi"
+	"../keys"
+	"../models"
+	"../query"
+	"../storage"
+	"github.com/tidwall/gjson"
+)
+
+// replayWorker records the responses of the fake API to the requests and
+// returns a worker replaying them, the fake API is closed by then
+func replayWorker(t *testing.T, requests []SearchRequest) *Worker {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	server := fakeapi.Start("../fakeapi/fixtures", fakeapi.Options{})
+	query.Keys = keys.NewPool([]string{"test-key"})
+	worker := &Worker{
+		Config:      config.Configuration{ResultsPerPage: 25, FixturesMode: query.RecordMode, FixturesPath: dir},
+		Storage:     storage.NewMemoryStorage(),
+		DataSources: testDataSources(t, server.URL),
+	}
+	for _, req := range requests {
+		_, err = worker.fetch(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	server.Close()
+	worker.Config.FixturesMode = query.ReplayMode
+	return worker
+}
+
+func (worker *Worker) fetch(req SearchRequest) (string, error) {
+	source, err := worker.extractSource(req.SourceName)
+	if err != nil {
+		return "", err
+	}
+	return query.MakeQuery(source.Path, req.ID, req.Fields, worker.Storage, worker.Config, true)
+}
+
+func TestExtractArticle(t *testing.T) {
+	authors := []models.Author{
+		{ScopusID: "7000000001", Initials: "A.", IndexedName: "Ivanov A.", Surname: "Ivanov", Name: "Alexey",
+			AffiliationID: []string{"60000001"}},
+		{ScopusID: "7000000002", Initials: "M.", IndexedName: "Petrova M.", Surname: "Petrova", Name: "Maria",
+			AffiliationID: []string{"60000001", "60000002"}},
+	}
+	affiliations := []models.Affiliation{{ScopusID: "60000001", Title: "ITMO University",
+		Country: "Russian Federation", City: "Saint Petersburg"}}
+	tests := []struct {
+		id         string
+		want       models.Article
+		references []string
+	}{
+		{"85000000001", models.Article{ScopusID: "85000000001", Title: "Crawling citation graphs at scale",
+			Abstracts: "Abstract of crawling citation graphs at scale.", PublicationDate: "2016-05-01",
+			CitationsCount: 12, PublicationType: "Journal", PublicationTitle: "Scientometrics",
+			Doi: "10.1000/sc.2016.1", Affiliations: affiliations, Authors: authors},
+			[]string{"85000000002", "85000000003"}},
+		{"85000000002", models.Article{ScopusID: "85000000002",
+			Title:     "Incremental indexing of bibliographic databases",
+			Abstracts: "Abstract of incremental indexing of bibliographic databases.", PublicationDate: "2015-09-01",
+			CitationsCount: 7, PublicationType: "Conference Proceeding", PublicationTitle: "Procedia Computer Science",
+			Doi: "10.1000/pcs.2015.2", Affiliations: affiliations, Authors: authors},
+			[]string{"85000000003"}},
+		{"85000000003", models.Article{ScopusID: "85000000003", Title: "A survey of scholarly data sources",
+			Abstracts: "Abstract of a survey of scholarly data sources.", PublicationDate: "2014-01-01",
+			CitationsCount: 30, PublicationType: "Journal", PublicationTitle: "Information Processing and Management",
+			Doi: "10.1000/ipm.2014.3", Affiliations: affiliations, Authors: authors},
+			nil},
+	}
+	var requests []SearchRequest
+	for _, test := range tests {
+		requests = append(requests, SearchRequest{SourceName: "article", ID: test.id})
+	}
+	worker := replayWorker(t, requests)
+	for _, test := range tests {
+		data, err := worker.fetch(SearchRequest{SourceName: "article", ID: test.id})
+		if err != nil {
+			t.Errorf("%s: %v", test.id, err)
+			continue
+		}
+		response := gjson.Get(data, "abstracts-retrieval-response")
+		var article models.Article
+		ExtractEntry(response, &article)
+		ExtractAuthors(response, &article)
+		ExtractAffiliation(response, &article)
+		if !reflect.DeepEqual(article, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.id, article, test.want)
+		}
+
+		ExtractKeywords(response, &article)
+		if len(article.Keywords) != 2 || article.Keywords[0].Value != "web crawling" ||
+			article.Keywords[1].Value != "bibliometrics" || article.Keywords[0].ID == article.Keywords[1].ID {
+			t.Errorf("%s: keywords %+v", test.id, article.Keywords)
+		}
+		ExtractSubjectArea(response, &article)
+		if len(article.SubjectAreas) != 1 || article.SubjectAreas[0].Title != "COMP" ||
+			article.SubjectAreas[0].Description != "Computer Science (all)" || article.SubjectAreas[0].ScopusID == "" {
+			t.Errorf("%s: subject areas %+v", test.id, article.SubjectAreas)
+		}
+
+		var references []string
+		for _, reference := range ExtractReferences(response) {
+			references = append(references, reference.ScopusID)
+			if reference.Title != "Reference source "+reference.ScopusID || len(reference.Authors) != 1 ||
+				reference.Authors[0].Surname != "Ivanov" {
+				t.Errorf("%s: reference %+v", test.id, reference)
+			}
+		}
+		if !reflect.DeepEqual(references, test.references) {
+			t.Errorf("%s: references %v, want %v", test.id, references, test.references)
+		}
+	}
+}
+
+func TestExtractSearch(t *testing.T) {
+	req := SearchRequest{SourceName: "search", Fields: map[string]string{"query": "TITLE(x)", "start": "0"}}
+	worker := replayWorker(t, []SearchRequest{req})
+	data, err := worker.fetch(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	articles, err := worker.ExtractArticles(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Article{{ScopusID: "85000000001"}, {ScopusID: "85000000002"}, {ScopusID: "85000000003"}}
+	if !reflect.DeepEqual(articles, want) {
+		t.Errorf("got %+v, want %+v", articles, want)
+	}
+	if _, err = worker.ExtractArticles(`{"service-error": {}}`); err == nil {
+		t.Error("response without search results is accepted")
+	}
+}
+
+func TestExtractAuthorProfile(t *testing.T) {
+	tests := []struct {
+		id    string
+		want  models.Author
+		areas []string
+	}{
+		{"7000000001", models.Author{ScopusID: "7000000001", Initials: "A.", IndexedName: "Ivanov A.",
+			Surname: "Ivanov", Name: "Alexey", AffiliationID: []string{"60000001"}, HIndex: 12, DocumentCount: 40,
+			CitedByCount: 950, CitationCount: 953, Orcid: "0000-0002-1825-0097",
+			NameVariants:       []string{"Ivanov A.A.", "Ivanov Alexey"},
+			AffiliationHistory: []string{"60000001", "60000002"}},
+			[]string{"Artificial Intelligence", "Applied Mathematics"}},
+		{"7000000002", models.Author{ScopusID: "7000000002", Initials: "M.", IndexedName: "Petrova M.",
+			Surname: "Petrova", Name: "Maria", AffiliationID: []string{"60000002"}, HIndex: 7, DocumentCount: 18,
+			CitedByCount: 210, CitationCount: 213, NameVariants: []string{"Petrova M.A."},
+			AffiliationHistory: []string{"60000002"}},
+			[]string{"Software"}},
+	}
+	var requests []SearchRequest
+	for _, test := range tests {
+		requests = append(requests, SearchRequest{SourceName: "author", ID: test.id})
+	}
+	worker := replayWorker(t, requests)
+	for _, test := range tests {
+		data, err := worker.fetch(SearchRequest{SourceName: "author", ID: test.id})
+		if err != nil {
+			t.Errorf("%s: %v", test.id, err)
+			continue
+		}
+		author := ExtractAuthorProfile(data)
+		var areas []string
+		for _, area := range author.SubjectAreas {
+			areas = append(areas, area.Description)
+		}
+		author.SubjectAreas = nil
+		if !reflect.DeepEqual(author, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.id, author, test.want)
+		}
+		if !reflect.DeepEqual(areas, test.areas) {
+			t.Errorf("%s: subject areas %v, want %v", test.id, areas, test.areas)
+		}
+	}
+}
+
+func TestGetAffiliation(t *testing.T) {
+	tests := []models.Affiliation{
+		{ScopusID: "60000001", Title: "ITMO University", Country: "Russian Federation", City: "Saint Petersburg",
+			PostalCode: "197101", Address: "Kronverksky Pr. 49"},
+		{ScopusID: "60000002", Title: "University of Amsterdam", Country: "Netherlands", City: "Amsterdam",
+			State: "Noord-Holland", PostalCode: "1012 WX", Address: "Spui 21"},
+	}
+	var requests []SearchRequest
+	for _, want := range tests {
+		requests = append(requests, SearchRequest{SourceName: "affiliation", ID: want.ScopusID})
+	}
+	worker := replayWorker(t, requests)
+	for _, want := range tests {
+		affiliation, err := worker.GetAffiliation(SearchRequest{SourceName: "affiliation", ID: want.ScopusID})
+		if err != nil {
+			t.Errorf("%s: %v", want.ScopusID, err)
+			continue
+		}
+		if affiliation != want {
+			t.Errorf("got %+v, want %+v", affiliation, want)
+		}
+	}
+	if _, err := worker.GetAffiliation(SearchRequest{SourceName: "affiliation", ID: "60000003"}); err == nil {
+		t.Error("request which was not recorded is replayed")
+	}
+}
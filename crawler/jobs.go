@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"../logger"
+	"../models"
+	"../storage"
+)
+
+func randomID() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func reportProgress(st storage.GenericStorage, jobID string, progress models.JobProgress) {
+	if jobID == "" {
+		return
+	}
+	err := st.UpdateJobProgress(jobID, progress)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+func (worker *Worker) reportProgress(jobID string, progress models.JobProgress) {
+	reportProgress(worker.Storage, jobID, progress)
+}
+
+func (worker *Worker) reportError(jobID string, err error) {
+	logger.Error.Println(err)
+	worker.reportProgress(jobID, models.JobProgress{Errors: 1, LastError: err.Error()})
+}
+
+func (worker *Worker) startTask(work SearchRequest) {
+	if work.JobID == "" {
+		return
+	}
+	err := worker.Storage.StartJob(work.JobID)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+// finishJob completes the job of the request when it has no tasks left
+func (worker *Worker) finishJob(work SearchRequest) {
+	if work.JobID == "" {
+		return
+	}
+	job, err := worker.Storage.GetJob(work.JobID)
+	if err != nil {
+		logger.Error.Println(err)
+		return
+	}
+	if job.PendingTasks > 0 || job.State != models.JobRunning {
+		return
+	}
+	state := models.JobDone
+	if job.ArticlesStored == 0 && job.Errors > 0 {
+		state = models.JobFailed
+	}
+	err = worker.Storage.UpdateJobState(work.JobID, state)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
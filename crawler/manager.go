@@ -3,49 +3,59 @@ package crawler
 import (
 	"encoding/json"
 	"errors"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"../models"
+	"../query"
 	"../storage"
 )
 
 type Manager struct {
 	DataSources []DataSource
-	Queue       chan SearchRequest
-	WorkerQueue chan chan SearchRequest
-	Storage     storage.MySqlStorage
+	Storage     storage.GenericStorage
+	// ApiURL replaces the scheme and host of the data source paths when set
+	ApiURL string
+	// Batcher groups the articles of the workers into transactions when set
+	Batcher *storage.ArticleBatcher
 }
 
+// Init starts the workers. Tasks left unfinished by a previous run are
+// returned to the queue, so the crawl resumes where it stopped.
 func (manager *Manager) Init(dataSourcesPath string, workersNumber int) error {
 	ds, err := manager.readDataSources(dataSourcesPath)
 	if err != nil {
 		return err
 	}
+	if manager.ApiURL != "" {
+		for i := range ds {
+			ds[i].Path = overrideHost(ds[i].Path, manager.ApiURL)
+		}
+	}
 	manager.DataSources = ds
-	manager.Queue = make(chan SearchRequest, 10000)
-	manager.WorkerQueue = make(chan chan SearchRequest, workersNumber)
-
+	for _, source := range ds {
+		query.Keys.SetRateLimit(source.Path, source.RateLimit)
+	}
+	err = manager.Storage.ReleaseTasks()
+	if err != nil {
+		return err
+	}
+	prefix, err := randomID()
+	if err != nil {
+		return err
+	}
 	for i := 0; i < workersNumber; i++ {
 		worker := Worker{
+			ID:          prefix + "-" + strconv.Itoa(i),
 			DataSources: ds,
-			Work:        make(chan SearchRequest),
-			WorkerQueue: manager.WorkerQueue,
 			Storage:     manager.Storage,
-			Queue:		 manager.Queue,
+			Batcher:     manager.Batcher,
 		}
 		worker.Start()
-		go func() {
-			for {
-				select {
-				case work := <-manager.Queue:
-					go func() {
-						worker := <-manager.WorkerQueue
-						worker <- work
-					}()
-				}
-			}
-		}()
 	}
 	return nil
 }
@@ -67,8 +77,37 @@ func (manager *Manager) readDataSources(path string) ([]DataSource, error) {
 	return ds, nil
 }
 
-func (manager *Manager) StartCrawling(req SearchRequest) error {
-	fieldsPart := map[string][]string{}
+// Limits of the searches a request is expanded into
+const (
+	maxRangeWidth   = 1000
+	maxCombinations = 1000
+)
+
+// InvalidRequestError is returned by StartCrawling for the requests which
+// can not be crawled, nothing is stored for them
+type InvalidRequestError struct {
+	Message string
+}
+
+func (err *InvalidRequestError) Error() string {
+	return err.Message
+}
+
+func invalidRequest(err error) error {
+	return &InvalidRequestError{err.Error()}
+}
+
+// IsInvalidRequest reports whether the request was refused by StartCrawling
+func IsInvalidRequest(err error) bool {
+	_, ok := err.(*InvalidRequestError)
+	return ok
+}
+
+// StartCrawling registers a new job for the request and queues its first
+// tasks. Fields with comma separated sets or ranges of values are expanded
+// into a search for every combination of the values. The request is checked
+// before anything is stored, the job is stored with its tasks at once.
+func (manager *Manager) StartCrawling(req SearchRequest) (models.Job, error) {
 	var dataSource DataSource
 	for _, ds := range manager.DataSources {
 		if ds.Name == req.SourceName {
@@ -77,13 +116,122 @@ func (manager *Manager) StartCrawling(req SearchRequest) error {
 		}
 	}
 	if dataSource.Name == "" {
-		return errors.New("incorrect data source name specified")
+		return models.Job{}, &InvalidRequestError{"incorrect data source name specified"}
 	}
-	firstKey := ""
-	for key, value := range req.Fields {
-		if firstKey == "" {
-			firstKey = key
+	fields, err := requestQuery(req)
+	if err != nil {
+		return models.Job{}, invalidRequest(err)
+	}
+	req.Fields = fields
+	fieldsPart, err := parseFields(dataSource, req.Fields)
+	if err != nil {
+		return models.Job{}, invalidRequest(err)
+	}
+	combinations, err := expandFields(fieldsPart)
+	if err != nil {
+		return models.Job{}, invalidRequest(err)
+	}
+	id, err := randomID()
+	if err != nil {
+		return models.Job{}, err
+	}
+	now := time.Now().Unix()
+	job := models.Job{
+		ID:         id,
+		SourceName: req.SourceName,
+		Fields:     req.Fields,
+		State:      models.JobQueued,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	req.JobID = job.ID
+	req.Source = dataSource
+	if req.SourceName == "search" {
+		req.SourceName = "PagesNum"
+	}
+	var splits []models.JobSplit
+	var tasks []models.Task
+	if len(combinations) == 1 {
+		req.Fields = combinations[0]
+		tasks = append(tasks, requestToTask(req))
+	} else {
+		parent := models.JobSplit{ID: taskKey(req), JobID: job.ID, Fields: req.Fields, SplitBy: "fields",
+			CreatedAt: time.Now().UnixNano()}
+		splits = append(splits, parent)
+		for _, fields := range combinations {
+			sub := req
+			sub.Fields = fields
+			splits = append(splits, models.JobSplit{ID: taskKey(sub), JobID: job.ID, ParentID: parent.ID,
+				Fields: fields, CreatedAt: time.Now().UnixNano()})
+			tasks = append(tasks, requestToTask(sub))
+		}
+	}
+	var visited []string
+	if req.SourceName == "article" {
+		visited = append(visited, req.ID)
+	}
+	err = manager.Storage.CreateJobWithTasks(job, splits, tasks, visited)
+	if err != nil {
+		return models.Job{}, err
+	}
+	job.PendingTasks = len(tasks)
+	return job, nil
+}
+
+// requestQuery puts the query of the request into its fields. Raw queries
+// are checked and unescaped if they were sent URL encoded as it used to be
+// required, see unescapeQuery.
+func requestQuery(req SearchRequest) (map[string]string, error) {
+	raw, ok := req.Fields["query"]
+	if req.Query != nil {
+		if ok {
+			return nil, errors.New("query was given both as a field and as a structured query")
 		}
+		rendered, err := req.Query.String()
+		if err != nil {
+			return nil, err
+		}
+		return withField(req.Fields, "query", rendered), nil
+	}
+	if !ok {
+		return req.Fields, nil
+	}
+	raw, err := unescapeQuery(raw, req.QueryEncoded)
+	if err != nil {
+		return nil, err
+	}
+	err = query.CheckQuery(raw)
+	if err != nil {
+		return nil, err
+	}
+	return withField(req.Fields, "query", raw), nil
+}
+
+// unescapeQuery decodes the raw query flagged as URL encoded. Queries which
+// are not flagged are decoded only if encoding them again gives them back, so
+// a query like TITLE(100% renewable) is taken as it is.
+func unescapeQuery(raw string, encoded bool) (string, error) {
+	unescaped, err := url.QueryUnescape(raw)
+	if encoded {
+		return unescaped, err
+	}
+	if err != nil || unescaped == raw {
+		return raw, nil
+	}
+	for _, escaped := range []string{url.QueryEscape(unescaped), url.PathEscape(unescaped)} {
+		if strings.EqualFold(escaped, raw) {
+			return unescaped, nil
+		}
+	}
+	return raw, nil
+}
+
+// parseFields checks the fields of the request against the data source and
+// reads their values: comma separated sets and ranges like 2010-2017. The
+// query is always taken as a single value.
+func parseFields(dataSource DataSource, fields map[string]string) (map[string][]string, error) {
+	fieldsPart := map[string][]string{}
+	for key, value := range fields {
 		checkDs := false
 		for _, dsField := range dataSource.Keys {
 			if key == dsField {
@@ -92,48 +240,105 @@ func (manager *Manager) StartCrawling(req SearchRequest) error {
 			}
 		}
 		if !checkDs {
-			return errors.New("key " + key + " was not found in data source " + dataSource.Name)
+			return nil, errors.New("key " + key + " was not found in data source " + dataSource.Name)
+		}
+		if key == "query" {
+			fieldsPart[key] = []string{value}
+			continue
 		}
-		fieldsPart[key] = []string{}
 		setParts := strings.Split(value, ",")
-		if len(setParts) > 1 || key == "query" {
+		if len(setParts) > 1 {
+			for i := range setParts {
+				setParts[i] = strings.TrimSpace(setParts[i])
+			}
 			fieldsPart[key] = setParts
-		} else {
-			rangeParts := strings.Split(value, "-")
-			if len(rangeParts) != 2 {
-				fieldsPart[key] = setParts
-				// return errors.New("search range for key " + key + " was specified incorrectly: " + value)
-			} else {
-				start, err := strconv.Atoi(rangeParts[0])
-				if err != nil {
-					return err
-				}
-				finish, err := strconv.Atoi(rangeParts[1])
-				if err != nil {
-					return err
-				}
-				if start > finish {
-					return errors.New("range error for key " + key + ": start value must be less or equal than finish value")
-				}
-				rangeSlice := make([]string, finish-start+1)
-				for i := range rangeSlice {
-					val := strconv.Itoa(start + i)
-					rangeSlice[i] = val
-				}
-				fieldsPart[key] = rangeSlice
+			continue
+		}
+		rangeParts := strings.Split(value, "-")
+		if len(rangeParts) != 2 {
+			fieldsPart[key] = setParts
+			continue
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(rangeParts[0]))
+		if err != nil {
+			return nil, err
+		}
+		finish, err := strconv.Atoi(strings.TrimSpace(rangeParts[1]))
+		if err != nil {
+			return nil, err
+		}
+		if start > finish {
+			return nil, errors.New("range error for key " + key + ": start value must be less or equal than finish value")
+		}
+		if finish-start >= maxRangeWidth {
+			return nil, errors.New("range error for key " + key + ": more than " + strconv.Itoa(maxRangeWidth) +
+				" values")
+		}
+		rangeSlice := make([]string, finish-start+1)
+		for i := range rangeSlice {
+			rangeSlice[i] = strconv.Itoa(start + i)
+		}
+		fieldsPart[key] = rangeSlice
+	}
+	return fieldsPart, nil
+}
+
+// expandFields makes the cartesian product of the field values, refusing
+// the products of more than maxCombinations searches
+func expandFields(fieldsPart map[string][]string) ([]map[string]string, error) {
+	keys := make([]string, 0, len(fieldsPart))
+	count := 1
+	for key, values := range fieldsPart {
+		keys = append(keys, key)
+		count *= len(values)
+		if count > maxCombinations {
+			return nil, errors.New("the fields make more than " + strconv.Itoa(maxCombinations) + " searches")
+		}
+	}
+	sort.Strings(keys)
+	combinations := []map[string]string{{}}
+	for _, key := range keys {
+		var next []map[string]string
+		for _, combination := range combinations {
+			for _, value := range fieldsPart[key] {
+				next = append(next, withField(combination, key, value))
 			}
 		}
+		combinations = next
 	}
-	if req.SourceName == "search" {
-		req.SourceName = "PagesNum"
-		manager.Queue <- req
+	return combinations, nil
+}
+
+// GetJob returns the job with the tree of its searches
+func (manager *Manager) GetJob(id string) (models.Job, error) {
+	job, err := manager.Storage.GetJob(id)
+	if err != nil {
+		return job, err
 	}
-	return nil
+	splits, err := manager.Storage.GetJobSplits(id)
+	if err != nil {
+		return job, err
+	}
+	job.Splits = splitTree(splits)
+	return job, nil
 }
 
-func min(a int, b int) int{
+// overrideHost points the path at another server, e.g. the fake Elsevier API
+func overrideHost(path string, apiURL string) string {
+	schemeEnd := strings.Index(path, "://")
+	if schemeEnd < 0 {
+		return path
+	}
+	hostEnd := strings.Index(path[schemeEnd+3:], "/")
+	if hostEnd < 0 {
+		return strings.TrimSuffix(apiURL, "/")
+	}
+	return strings.TrimSuffix(apiURL, "/") + path[schemeEnd+3+hostEnd:]
+}
+
+func min(a int, b int) int {
 	if a > b {
 		return b
 	}
 	return a
-}
\ No newline at end of file
+}
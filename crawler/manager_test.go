@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"testing"
+
+	"../query"
+)
+
+func TestUnescapeQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		encoded bool
+		want    string
+	}{
+		{"plain", "TITLE(graph)", false, "TITLE(graph)"},
+		{"percent sign", "TITLE(100% renewable)", false, "TITLE(100% renewable)"},
+		{"percent sign and a code", "TITLE(100%25 renewable)", false, "TITLE(100%25 renewable)"},
+		{"plus sign", "TITLE(a+b)", false, "TITLE(a+b)"},
+		{"partly encoded", "TITLE(x)%20AND%20PUBYEAR%20%3E%202010", false, "TITLE(x)%20AND%20PUBYEAR%20%3E%202010"},
+		{"query encoded", "TITLE%28crawling+graphs%29", false, "TITLE(crawling graphs)"},
+		{"path encoded", "TITLE%28crawling%20graphs%29", false, "TITLE(crawling graphs)"},
+		{"lower case codes", "TITLE%28crawling%2bgraphs%29", false, "TITLE(crawling+graphs)"},
+		{"flagged", "TITLE%28100%25%20renewable%29", true, "TITLE(100% renewable)"},
+		{"flagged partly encoded", "TITLE(100%25 renewable)", true, "TITLE(100% renewable)"},
+		{"flagged plus sign", "TITLE(a+b)", true, "TITLE(a b)"},
+	}
+	for _, test := range tests {
+		got, err := unescapeQuery(test.raw, test.encoded)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+	if got, err := unescapeQuery("TITLE(100% renewable)", true); err == nil {
+		t.Errorf("invalid flagged query is decoded into %q", got)
+	}
+}
+
+func TestRequestQuery(t *testing.T) {
+	structured := query.And(query.Term(query.TitleAbsKey, "crawling"), query.Year("AFT", 2010))
+	tests := []struct {
+		name string
+		req  SearchRequest
+		want string
+	}{
+		{"raw", SearchRequest{Fields: map[string]string{"query": "TITLE(100% renewable)"}},
+			"TITLE(100% renewable)"},
+		{"encoded", SearchRequest{Fields: map[string]string{"query": "TITLE%28x%29"}, QueryEncoded: true},
+			"TITLE(x)"},
+		{"structured", SearchRequest{Fields: map[string]string{"date": "2016"}, Query: &structured},
+			"TITLE-ABS-KEY(crawling) AND PUBYEAR AFT 2010"},
+		{"no query", SearchRequest{Fields: map[string]string{"date": "2016"}}, ""},
+	}
+	for _, test := range tests {
+		fields, err := requestQuery(test.req)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if fields["query"] != test.want {
+			t.Errorf("%s: query %q, want %q", test.name, fields["query"], test.want)
+		}
+	}
+
+	rejected := []struct {
+		name string
+		req  SearchRequest
+	}{
+		{"query field and structured query", SearchRequest{Fields: map[string]string{"query": "TITLE(x)"},
+			Query: &structured}},
+		{"invalid structured query", SearchRequest{Query: &query.Query{}}},
+		{"unbalanced brackets", SearchRequest{Fields: map[string]string{"query": "TITLE(x))"}}},
+		{"unbalanced encoded brackets", SearchRequest{Fields: map[string]string{"query": "TITLE%28x"}}},
+		{"unbalanced quotes", SearchRequest{Fields: map[string]string{"query": `TITLE("x)`}}},
+		{"invalid encoding", SearchRequest{Fields: map[string]string{"query": "TITLE(100%)"}, QueryEncoded: true}},
+	}
+	for _, test := range rejected {
+		if fields, err := requestQuery(test.req); err == nil {
+			t.Errorf("%s: query %q is accepted", test.name, fields["query"])
+		}
+	}
+}
@@ -1,14 +1,35 @@
 package crawler
 
+import (
+	"../query"
+)
+
 type DataSource struct {
 	Name string
 	Path string
 	Keys []string
+	// RateLimit is the number of requests per second allowed to the source, 0 means no limit
+	RateLimit float64
+	// Paging of the search results, offset by default or cursor
+	Paging string
 }
 
+// CursorPaging follows the search results with the Scopus cursor, it is not
+// limited by the number of results like the offset paging
+const CursorPaging = "cursor"
+
 type SearchRequest struct {
 	SourceName string
 	Source     DataSource
 	ID         string
 	Fields     map[string]string
+	// Query is rendered into the query field, instead of giving it as a raw string
+	Query *query.Query
+	// QueryEncoded marks the raw query field as URL encoded
+	QueryEncoded bool
+	JobID        string
+	// BypassCache makes the request and the tasks it spawns ignore cached responses
+	BypassCache bool
+	// Depth of the article in the references graph of the job
+	Depth int
 }
@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"../models"
+	"../query"
+)
+
+// searchResultsCap is the number of results Scopus returns for a search
+const searchResultsCap = 5000
+
+// firstSearchYear bounds the searches without a date
+const firstSearchYear = 1800
+
+var months = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September",
+	"October", "November", "December"}
+
+// splitSearch narrows the search fields: the date range is halved down to
+// single years, then the year is split by subject areas and at last by months.
+// It returns an empty split when the search cannot be narrowed any more. The
+// split is not complete when the children miss some of the results.
+func splitSearch(fields map[string]string) (string, []map[string]string, bool) {
+	from, to, ok := parseYears(fields["date"])
+	if fields["date"] == "" {
+		from, to, ok = firstSearchYear, time.Now().Year()+1, true
+	}
+	if !ok {
+		return "", nil, false
+	}
+	if from < to {
+		middle := (from + to) / 2
+		return "date", []map[string]string{
+			withField(fields, "date", yearRange(from, middle)),
+			withField(fields, "date", yearRange(middle+1, to)),
+		}, true
+	}
+	if fields["subj"] == "" {
+		var children []map[string]string
+		for _, area := range query.SubjectAreas {
+			children = append(children, withField(fields, "subj", area))
+		}
+		return "subj", children, true
+	}
+	if strings.Contains(fields["query"], "PUBDATETXT") {
+		return "", nil, false
+	}
+	var children []map[string]string
+	var rest []string
+	for _, month := range months {
+		clause := "PUBDATETXT(" + month + " " + strconv.Itoa(from) + ")"
+		children = append(children, withField(fields, "query", andClause(fields["query"], clause)))
+		rest = append(rest, "NOT "+clause)
+	}
+	// the last child gets the articles without a publication month, Scopus
+	// refuses a query made of the negations only
+	if fields["query"] == "" {
+		return "month", children, false
+	}
+	children = append(children, withField(fields, "query", andClause(fields["query"], strings.Join(rest, " AND "))))
+	return "month", children, true
+}
+
+// parseYears reads the date field of the search, either a year or a range of years
+func parseYears(date string) (int, int, bool) {
+	parts := strings.Split(date, "-")
+	if len(parts) > 2 {
+		return 0, 0, false
+	}
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	to := from
+	if len(parts) == 2 {
+		to, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || to < from {
+			return 0, 0, false
+		}
+	}
+	return from, to, true
+}
+
+func yearRange(from int, to int) string {
+	if from == to {
+		return strconv.Itoa(from)
+	}
+	return strconv.Itoa(from) + "-" + strconv.Itoa(to)
+}
+
+func withField(fields map[string]string, key string, value string) map[string]string {
+	result := make(map[string]string, len(fields)+1)
+	for k, v := range fields {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+// andClause appends the clause to the raw query
+func andClause(raw string, clause string) string {
+	if raw == "" {
+		return clause
+	}
+	return "(" + raw + ") AND " + clause
+}
+
+// splitTree nests the splits of a job under their parents
+func splitTree(splits []models.JobSplit) []models.JobSplit {
+	children := map[string][]models.JobSplit{}
+	for _, split := range splits {
+		children[split.ParentID] = append(children[split.ParentID], split)
+	}
+	var build func(parentID string) []models.JobSplit
+	build = func(parentID string) []models.JobSplit {
+		nodes := children[parentID]
+		for i := range nodes {
+			nodes[i].Children = build(nodes[i].ID)
+		}
+		return nodes
+	}
+	return build("")
+}
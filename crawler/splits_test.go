@@ -0,0 +1,108 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"../query"
+)
+
+func TestSplitSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		splitBy  string
+		children int
+		complete bool
+		first    map[string]string
+		last     map[string]string
+	}{
+		{
+			name:     "date range is halved",
+			fields:   map[string]string{"query": "TITLE(x)", "date": "2000-2003"},
+			splitBy:  "date",
+			children: 2,
+			complete: true,
+			first:    map[string]string{"query": "TITLE(x)", "date": "2000-2001"},
+			last:     map[string]string{"query": "TITLE(x)", "date": "2002-2003"},
+		},
+		{
+			name:     "single year is split by subject areas",
+			fields:   map[string]string{"query": "TITLE(x)", "date": "2000"},
+			splitBy:  "subj",
+			children: len(query.SubjectAreas),
+			complete: true,
+			first:    map[string]string{"query": "TITLE(x)", "date": "2000", "subj": query.SubjectAreas[0]},
+		},
+		{
+			name:     "subject area is split by months",
+			fields:   map[string]string{"query": "TITLE(x)", "date": "2000", "subj": "MATH"},
+			splitBy:  "month",
+			children: len(months) + 1,
+			complete: true,
+			first:    map[string]string{"query": "(TITLE(x)) AND PUBDATETXT(January 2000)", "date": "2000", "subj": "MATH"},
+			last: map[string]string{"date": "2000", "subj": "MATH", "query": "(TITLE(x)) AND " +
+				"NOT PUBDATETXT(January 2000) AND NOT PUBDATETXT(February 2000) AND NOT PUBDATETXT(March 2000) AND " +
+				"NOT PUBDATETXT(April 2000) AND NOT PUBDATETXT(May 2000) AND NOT PUBDATETXT(June 2000) AND " +
+				"NOT PUBDATETXT(July 2000) AND NOT PUBDATETXT(August 2000) AND NOT PUBDATETXT(September 2000) AND " +
+				"NOT PUBDATETXT(October 2000) AND NOT PUBDATETXT(November 2000) AND NOT PUBDATETXT(December 2000)"},
+		},
+		{
+			name:     "months without a base query are truncated",
+			fields:   map[string]string{"date": "2000", "subj": "MATH"},
+			splitBy:  "month",
+			children: len(months),
+			complete: false,
+			first:    map[string]string{"query": "PUBDATETXT(January 2000)", "date": "2000", "subj": "MATH"},
+			last:     map[string]string{"query": "PUBDATETXT(December 2000)", "date": "2000", "subj": "MATH"},
+		},
+		{
+			name:   "month split stops",
+			fields: map[string]string{"query": "(x) AND PUBDATETXT(May 2000)", "date": "2000", "subj": "MATH"},
+		},
+		{
+			name:   "invalid date is not split",
+			fields: map[string]string{"query": "TITLE(x)", "date": "2003-2000"},
+		},
+	}
+	for _, test := range tests {
+		splitBy, children, complete := splitSearch(test.fields)
+		if splitBy != test.splitBy || len(children) != test.children || complete != test.complete {
+			t.Errorf("%s: got %q, %d children, complete %v", test.name, splitBy, len(children), complete)
+			continue
+		}
+		for _, child := range children {
+			if strings.HasPrefix(child["query"], "NOT") {
+				t.Errorf("%s: child query %q starts with NOT", test.name, child["query"])
+			}
+		}
+		if test.first != nil && !equalFields(children[0], test.first) {
+			t.Errorf("%s: first child %v, want %v", test.name, children[0], test.first)
+		}
+		if test.last != nil && !equalFields(children[len(children)-1], test.last) {
+			t.Errorf("%s: last child %v, want %v", test.name, children[len(children)-1], test.last)
+		}
+	}
+}
+
+func TestSplitSearchWithoutDate(t *testing.T) {
+	splitBy, children, complete := splitSearch(map[string]string{"query": "TITLE(x)"})
+	if splitBy != "date" || len(children) != 2 || !complete {
+		t.Fatalf("got %q, %d children, complete %v", splitBy, len(children), complete)
+	}
+	if !strings.HasPrefix(children[0]["date"], "1800-") {
+		t.Errorf("first child date %q does not start at 1800", children[0]["date"])
+	}
+}
+
+func equalFields(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range b {
+		if a[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+
+	"../logger"
+	"../models"
+	"../storage"
+)
+
+const defaultTaskLease = 600
+
+// taskKey identifies the work a request describes within its job
+func taskKey(req SearchRequest) string {
+	keys := make([]string, 0, len(req.Fields))
+	for key := range req.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha1.New()
+	h.Write([]byte(req.JobID + "|" + req.SourceName + "|" + req.ID))
+	for _, key := range keys {
+		h.Write([]byte("|" + key + "=" + req.Fields[key]))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func requestToTask(req SearchRequest) models.Task {
+	return models.Task{
+		Key:         taskKey(req),
+		JobID:       req.JobID,
+		SourceName:  req.SourceName,
+		ScopusID:    req.ID,
+		Fields:      req.Fields,
+		BypassCache: req.BypassCache,
+		Depth:       req.Depth,
+	}
+}
+
+func (worker *Worker) requestFromTask(task models.Task) SearchRequest {
+	req := SearchRequest{
+		SourceName:  task.SourceName,
+		ID:          task.ScopusID,
+		Fields:      task.Fields,
+		JobID:       task.JobID,
+		BypassCache: task.BypassCache,
+		Depth:       task.Depth,
+	}
+	// PagesNum tasks are planned over the search data source
+	sourceName := task.SourceName
+	if sourceName == "PagesNum" {
+		sourceName = "search"
+	}
+	req.Source, _ = worker.extractSource(sourceName)
+	return req
+}
+
+// enqueue puts the request into the storage backed queue
+func enqueue(st storage.GenericStorage, req SearchRequest) error {
+	return st.CreateTask(requestToTask(req))
+}
+
+func (worker *Worker) enqueue(req SearchRequest) {
+	err := enqueue(worker.Storage, req)
+	if err != nil {
+		worker.reportError(req.JobID, err)
+	}
+}
+
+// enqueueArticle queues the article unless the job has already visited it
+func (worker *Worker) enqueueArticle(req SearchRequest) {
+	if req.ID == "" {
+		return
+	}
+	_, err := worker.Storage.CreateVisitedTask(requestToTask(req))
+	if err != nil {
+		worker.reportError(req.JobID, err)
+	}
+}
+
+func (worker *Worker) completeTask(task models.Task, taskErr error) {
+	var err error
+	if taskErr != nil {
+		err = worker.Storage.FailTask(task.ID, taskErr.Error())
+	} else {
+		err = worker.Storage.CompleteTask(task.ID)
+	}
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
@@ -3,9 +3,9 @@ package crawler
 import (
 	"errors"
 	"hash/fnv"
-	"log"
 	"strconv"
 	"strings"
+	"time"
 
 	"../config"
 	"../logger"
@@ -16,84 +16,118 @@ import (
 )
 
 type Worker struct {
+	ID          string
 	Config      config.Configuration
-	Storage     storage.MySqlStorage
+	Storage     storage.GenericStorage
+	Batcher     *storage.ArticleBatcher
 	DataSources []DataSource
-	Work        chan SearchRequest
-	WorkerQueue chan chan SearchRequest
-	Queue       chan SearchRequest
 }
 
+const pollInterval = time.Second
+
+// Start runs the worker loop, leasing tasks from the storage queue one by one
 func (worker *Worker) Start() {
 	go func() {
 		worker.Config, _ = config.ReadConfig("config.json")
-		worker.Config.InitKeys("keys.txt")
-	loop:
+		leaseSec := worker.Config.TaskLeaseTimeout
+		if leaseSec <= 0 {
+			leaseSec = defaultTaskLease
+		}
+		lease := time.Duration(leaseSec) * time.Second
 		for {
-			worker.WorkerQueue <- worker.Work
-			work := <-worker.Work
-			switch work.SourceName {
-			case "affiliation":
-				affiliation, err := worker.GetAffiliation(work)
-				if err == nil {
-					worker.Storage.CreateAffiliation(affiliation)
-				} else {
-					log.Println(err)
-				}
-			case "PagesNum":
-				requests := worker.formPagesSearchField(work)
-				for _, req := range requests {
-					req.SourceName = "search"
-					worker.Queue <- req
-				}
-			case "search":
-				source, err := worker.extractSource("search")
-				if err != nil {
-					logger.Error.Println(err)
-					continue loop
-				}
-				data, err := query.MakeQuery(source.Path, "", work.Fields, worker.Config.RequestTimeout, worker.Storage, worker.Config)
-				if err != nil {
-					logger.Error.Println(err)
-					continue loop
-				}
-				articles, err := worker.ExtractArticles(data)
-				if err != nil {
+			err := worker.runTask(lease)
+			if err != nil {
+				if err != storage.ErrNotFound {
 					logger.Error.Println(err)
-					continue loop
-				}
-				var articleDs DataSource
-				for _, v := range worker.DataSources {
-					if v.Name == "article" {
-						articleDs = v
-						break
-					}
-				}
-				for _, article := range articles {
-					worker.Queue <- SearchRequest{"article", articleDs, article.ScopusID, nil}
-				}
-			case "article":
-				art := models.Article{ScopusID: work.ID}
-				err := worker.ProceedArticle(&art, work.Source, 0)
-				if err != nil {
-					logger.Error.Println(err)
-					continue loop
 				}
+				time.Sleep(pollInterval)
 			}
 		}
 	}()
 }
 
+// runTask leases the next task and handles it. The errors of the task are
+// reported to its job, ErrNotFound is returned when the queue is empty.
+func (worker *Worker) runTask(lease time.Duration) error {
+	task, err := worker.Storage.LeaseTask(worker.ID, lease)
+	if err != nil {
+		return err
+	}
+	work := worker.requestFromTask(task)
+	worker.startTask(work)
+	err = worker.handle(work)
+	if err != nil {
+		worker.reportError(work.JobID, err)
+	}
+	worker.completeTask(task, err)
+	worker.finishJob(work)
+	return nil
+}
+
+func (worker *Worker) handle(work SearchRequest) error {
+	switch work.SourceName {
+	case "affiliation":
+		affiliation, err := worker.GetAffiliation(work)
+		if err != nil {
+			return err
+		}
+		return worker.Storage.CreateAffiliation(affiliation)
+	case "PagesNum":
+		return worker.planSearch(work)
+	case "search":
+		source, err := worker.extractSource("search")
+		if err != nil {
+			return err
+		}
+		data, err := query.MakeQuery(source.Path, "", work.Fields, worker.Storage, worker.Config,
+			work.BypassCache)
+		if err != nil {
+			return err
+		}
+		articles, err := worker.ExtractArticles(data)
+		if err != nil {
+			return err
+		}
+		articleDs, err := worker.extractSource("article")
+		if err != nil {
+			return err
+		}
+		found := 0
+		for _, article := range articles {
+			if article.ScopusID == "" {
+				continue
+			}
+			found++
+			worker.enqueueArticle(SearchRequest{SourceName: "article", Source: articleDs, ID: article.ScopusID,
+				JobID: work.JobID, BypassCache: work.BypassCache})
+		}
+		if _, ok := work.Fields["cursor"]; ok {
+			worker.enqueueNextPage(work, data, found)
+		}
+	case "article":
+		art := models.Article{ScopusID: work.ID}
+		return worker.ProceedArticle(&art, work)
+	case "citedby":
+		return worker.proceedCitedBy(work)
+	case "author":
+		return worker.proceedAuthor(work)
+	case "authorDocuments":
+		return worker.proceedAuthorDocuments(work)
+	}
+	return nil
+}
+
 func (worker *Worker) GetAffiliation(req SearchRequest) (models.Affiliation, error) {
 	source, err := worker.extractSource(req.SourceName)
 	if err != nil {
 		return models.Affiliation{}, err
 	}
-	data, err := query.MakeQuery(source.Path, req.ID, req.Fields, worker.Config.RequestTimeout, worker.Storage, worker.Config)
+	data, err := query.MakeQuery(source.Path, req.ID, req.Fields, worker.Storage, worker.Config,
+		req.BypassCache)
 	if err != nil {
 		return models.Affiliation{}, err
 	}
-	affildata := gjson.Get(data, "affiliation-retreival-response")
+	affildata := gjson.Get(data, "affiliation-retrieval-response")
 	result := models.Affiliation{}
 	result.ScopusID = req.ID
 	add := affildata.Get("address")
@@ -112,6 +146,19 @@ func (worker *Worker) GetAffiliation(req SearchRequest) (models.Affiliation, err
 	if title.Exists() {
 		result.Title = title.String()
 	}
+	// the institution profile has the complete address
+	address := affildata.Get("institution-profile.address")
+	if part := address.Get("address-part").String(); part != "" {
+		result.Address = part
+	}
+	if city := address.Get("city").String(); city != "" {
+		result.City = city
+	}
+	if country := address.Get("country").String(); country != "" {
+		result.Country = country
+	}
+	result.State = address.Get("state").String()
+	result.PostalCode = address.Get("postal-code").String()
 	return result, nil
 }
 
@@ -120,7 +167,8 @@ func (worker *Worker) getMaxResults(req SearchRequest) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	data, err := query.MakeQuery(source.Path, "", req.Fields, worker.Config.RequestTimeout, worker.Storage, worker.Config)
+	data, err := query.MakeQuery(source.Path, "", req.Fields, worker.Storage, worker.Config,
+		req.BypassCache)
 	if err != nil {
 		return 0, err
 	}
@@ -134,13 +182,111 @@ func (worker *Worker) getMaxResults(req SearchRequest) (int, error) {
 	return total, nil
 }
 
-func (worker *Worker) formPagesSearchField(req SearchRequest) []SearchRequest {
-	maxSearchResults, err := worker.getMaxResults(req)
+// planSearch queues the pages of the search. Searches with more results than
+// Scopus returns are split into narrower ones, which are planned the same way.
+func (worker *Worker) planSearch(work SearchRequest) error {
+	total, err := worker.getMaxResults(work)
 	if err != nil {
-		log.Println(err)
+		return err
+	}
+	split := models.JobSplit{ID: taskKey(work), JobID: work.JobID, Fields: work.Fields, TotalResults: total,
+		CreatedAt: time.Now().UnixNano()}
+	err = worker.Storage.CreateJobSplit(split)
+	if err != nil {
+		return err
+	}
+	if work.Source.Paging == CursorPaging {
+		split.SplitBy = CursorPaging
+		split.Pages = 1
+		err = worker.Storage.UpdateJobSplit(split)
+		if err != nil {
+			return err
+		}
+		worker.reportProgress(work.JobID, models.JobProgress{PagesPlanned: 1})
+		worker.enqueue(SearchRequest{SourceName: "search", Source: work.Source,
+			Fields: withField(work.Fields, "cursor", "*"), JobID: work.JobID, BypassCache: work.BypassCache})
 		return nil
 	}
-	maxPages := min(maxSearchResults/worker.Config.ResultsPerPage, 4975/worker.Config.ResultsPerPage)
+	if total > searchResultsCap {
+		splitBy, children, complete := splitSearch(work.Fields)
+		if splitBy != "" {
+			split.SplitBy = splitBy
+			split.Truncated = !complete
+			err = worker.Storage.UpdateJobSplit(split)
+			if err != nil {
+				return err
+			}
+			if !complete {
+				worker.reportError(work.JobID, errors.New("search "+split.ID+
+					" is truncated: the articles without a publication month need a base query"))
+			}
+			for _, fields := range children {
+				child := SearchRequest{SourceName: "PagesNum", Source: work.Source, Fields: fields, JobID: work.JobID,
+					BypassCache: work.BypassCache}
+				err = worker.Storage.CreateJobSplit(models.JobSplit{ID: taskKey(child), JobID: work.JobID,
+					ParentID: split.ID, Fields: fields, CreatedAt: time.Now().UnixNano()})
+				if err != nil {
+					return err
+				}
+				worker.enqueue(child)
+			}
+			return nil
+		}
+		split.Truncated = true
+	}
+	requests := worker.formPagesSearchField(work, total)
+	split.Pages = len(requests)
+	err = worker.Storage.UpdateJobSplit(split)
+	if err != nil {
+		return err
+	}
+	worker.reportProgress(work.JobID, models.JobProgress{PagesPlanned: len(requests)})
+	for _, req := range requests {
+		req.SourceName = "search"
+		worker.enqueue(req)
+	}
+	return nil
+}
+
+// enqueueNextPage queues the page of the search results following the one in
+// data. The queued task keeps the cursor or the offset in the storage, so an
+// interrupted crawl resumes from it.
+func (worker *Worker) enqueueNextPage(work SearchRequest, data string, found int) {
+	fields := nextPage(work.Fields, data, found)
+	if fields == nil {
+		return
+	}
+	worker.reportProgress(work.JobID, models.JobProgress{PagesPlanned: 1})
+	next := work
+	next.Fields = fields
+	worker.enqueue(next)
+}
+
+// nextPage returns the fields of the page following the one in data, or nil
+// if it was the last page
+func nextPage(fields map[string]string, data string, found int) map[string]string {
+	if found == 0 {
+		return nil
+	}
+	if _, ok := fields["cursor"]; ok {
+		cursor := gjson.Get(data, `search-results.cursor.\@next`).String()
+		if cursor == "" || cursor == fields["cursor"] {
+			return nil
+		}
+		return withField(fields, "cursor", cursor)
+	}
+	start, _ := strconv.Atoi(fields["start"])
+	total := int(gjson.Get(data, "search-results.opensearch:totalResults").Int())
+	next := start + found
+	if next >= total || next >= searchResultsCap {
+		return nil
+	}
+	return withField(fields, "start", strconv.Itoa(next))
+}
+
+func (worker *Worker) formPagesSearchField(req SearchRequest, maxSearchResults int) []SearchRequest {
+	maxPages := min(maxSearchResults/worker.Config.ResultsPerPage,
+		(searchResultsCap-worker.Config.ResultsPerPage)/worker.Config.ResultsPerPage)
 	result := make([]map[string]string, maxPages+1)
 	counter := 0
 	for i := 0; i < maxPages+1; i++ {
@@ -154,7 +300,8 @@ func (worker *Worker) formPagesSearchField(req SearchRequest) []SearchRequest {
 	}
 	rv := []SearchRequest{}
 	for _, f := range result {
-		workerReq := SearchRequest{SourceName: req.SourceName, Source: req.Source, Fields: f}
+		workerReq := SearchRequest{SourceName: req.SourceName, Source: req.Source, Fields: f, JobID: req.JobID,
+			BypassCache: req.BypassCache}
 		rv = append(rv, workerReq)
 	}
 	return rv
@@ -386,33 +533,101 @@ func (worker *Worker) extractSource(sourceName string) (DataSource, error) {
 	return DataSource{}, errors.New("data source not found")
 }
 
-func (worker *Worker) ProceedArticle(article *models.Article, articleDs DataSource, depth int) error {
+// enqueueAffiliations queues the retrieval of the affiliations which were not retrieved yet
+func (worker *Worker) enqueueAffiliations(work SearchRequest, ids []string) {
+	source, err := worker.extractSource("affiliation")
+	if err != nil {
+		worker.reportError(work.JobID, err)
+		return
+	}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		exists, err := worker.Storage.CheckAffiliation(id)
+		if err != nil {
+			worker.reportError(work.JobID, err)
+			continue
+		}
+		if !exists {
+			worker.enqueue(SearchRequest{SourceName: "affiliation", Source: source, ID: id, JobID: work.JobID,
+				BypassCache: work.BypassCache})
+		}
+	}
+}
+
+func (worker *Worker) storeArticle(article models.Article) error {
+	if worker.Batcher != nil {
+		return worker.Batcher.Store(article)
+	}
+	return worker.Storage.CreateArticle(article)
+}
+
+// ProceedArticle fetches and stores the article. Its references are queued
+// as articles of the next depth until config.ReferencesDepth is reached, the
+// articles citing it are searched until config.CitedByDepth is reached.
+// Articles found by following one direction are not expanded in the other.
+func (worker *Worker) ProceedArticle(article *models.Article, work SearchRequest) error {
 	source, err := worker.extractSource("article")
 	if err != nil {
 		return err
 	}
-	articleData, err := query.MakeQuery(source.Path, article.ScopusID, map[string]string{}, worker.Config.RequestTimeout,
-		worker.Storage, worker.Config)
+	articleData, err := query.MakeQuery(source.Path, article.ScopusID, map[string]string{},
+		worker.Storage, worker.Config, work.BypassCache)
 	if err != nil {
 		logger.Error.Println("Error on requesting data for id=" + article.ScopusID)
-		logger.Error.Println(err)
+		return err
 	}
+	worker.reportProgress(work.JobID, models.JobProgress{ArticlesFetched: 1})
 	response := gjson.Get(articleData, "abstracts-retrieval-response")
 	ExtractAffiliation(response, article)
 	ExtractEntry(response, article)
 	ExtractAuthors(response, article)
 	ExtractKeywords(response, article)
 	ExtractSubjectArea(response, article)
+	affiliationIDs := flattenAffiliations(article.Affiliations)
+	for _, author := range article.Authors {
+		affiliationIDs = append(affiliationIDs, author.AffiliationID...)
+	}
+	worker.enqueueAffiliations(work, affiliationIDs)
 	references := ExtractReferences(response)
-	if depth < worker.Config.ReferencesDepth {
+	citedByDepth := citedByDepth(work)
+	if citedByDepth == 0 && work.Depth < worker.Config.ReferencesDepth {
 		for _, ref := range references {
-			worker.ProceedArticle(&ref, articleDs, depth+1)
+			// references without an ID can not be crawled nor linked
+			if ref.ScopusID == "" {
+				continue
+			}
+			worker.enqueueArticle(SearchRequest{SourceName: "article", Source: source, ID: ref.ScopusID,
+				JobID: work.JobID, BypassCache: work.BypassCache, Depth: work.Depth + 1})
 			article.References = append(article.References, ref)
 		}
 	}
-	err = worker.Storage.CreateArticle(*article)
+	err = worker.storeArticle(*article)
 	if err != nil {
+		logger.Error.Println(err)
 		return errors.New("Error writing article to database")
 	}
+	worker.reportProgress(work.JobID, models.JobProgress{ArticlesStored: 1})
+	if worker.Config.CrawlAuthors {
+		authorDs, err := worker.extractSource("author")
+		if err != nil {
+			return err
+		}
+		for _, author := range article.Authors {
+			if author.ScopusID != "" {
+				worker.enqueue(SearchRequest{SourceName: "author", Source: authorDs, ID: author.ScopusID,
+					JobID: work.JobID, BypassCache: work.BypassCache})
+			}
+		}
+	}
+	if work.Depth == 0 && citedByDepth < worker.Config.CitedByDepth {
+		citedBySource, err := worker.extractSource("citedby")
+		if err != nil {
+			return err
+		}
+		worker.enqueue(SearchRequest{SourceName: "citedby", Source: citedBySource, ID: article.ScopusID,
+			JobID: work.JobID, BypassCache: work.BypassCache, Depth: citedByDepth})
+	}
 	return nil
 }
@@ -0,0 +1,243 @@
+package fakeapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options control how the fake server imitates Elsevier limits
+type Options struct {
+	// Keys accepted by the server, any key is accepted when empty
+	Keys []string
+	// Quota is the number of requests a key may send within QuotaPeriod, unlimited when zero
+	Quota       int
+	QuotaPeriod time.Duration
+	// Latency is added to every response
+	Latency time.Duration
+}
+
+// Server serves Scopus Search, Abstract Retrieval, Author Retrieval and
+// Affiliation Retrieval responses from a fixtures directory:
+//
+//	search.json                the entries of the search results
+//	abstract/<scopus_id>.json  abstract retrieval responses
+//	author/<id>.json           author retrieval responses
+//	affiliation/<id>.json      affiliation retrieval responses
+type Server struct {
+	Fixtures string
+	Options  Options
+	mutex    sync.Mutex
+	usage    map[string]*keyUsage
+}
+
+type keyUsage struct {
+	used  int
+	reset time.Time
+}
+
+const (
+	defaultCount     = 25
+	maxSearchResults = 5000
+)
+
+func New(fixtures string, options Options) *Server {
+	if options.QuotaPeriod <= 0 {
+		options.QuotaPeriod = time.Hour
+	}
+	return &Server{Fixtures: fixtures, Options: options, usage: map[string]*keyUsage{}}
+}
+
+// Start runs the server on a local port, the caller closes it
+func Start(fixtures string, options Options) *httptest.Server {
+	return httptest.NewServer(New(fixtures, options))
+}
+
+func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if server.Options.Latency > 0 {
+		time.Sleep(server.Options.Latency)
+	}
+	if !server.authorize(writer, request.URL.Query().Get("apiKey")) {
+		return
+	}
+	path := request.URL.Path
+	switch {
+	case path == "/content/search/scopus":
+		server.search(writer, request)
+	case strings.HasPrefix(path, "/content/abstract/scopus_id/"):
+		server.serveFile(writer, "abstract", strings.TrimPrefix(path, "/content/abstract/scopus_id/"))
+	case strings.HasPrefix(path, "/content/author/author_id/"):
+		server.serveFile(writer, "author", strings.TrimPrefix(path, "/content/author/author_id/"))
+	case strings.HasPrefix(path, "/content/affiliation/affiliation_id/"):
+		server.serveFile(writer, "affiliation", strings.TrimPrefix(path, "/content/affiliation/affiliation_id/"))
+	default:
+		writeError(writer, http.StatusNotFound, "RESOURCE_NOT_FOUND", "Unknown resource "+path)
+	}
+}
+
+// authorize checks the key and its quota and sets the rate limit headers
+func (server *Server) authorize(writer http.ResponseWriter, key string) bool {
+	if len(server.Options.Keys) > 0 && !contains(server.Options.Keys, key) {
+		writeError(writer, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Invalid API Key")
+		return false
+	}
+	if server.Options.Quota <= 0 {
+		return true
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	now := time.Now()
+	usage, ok := server.usage[key]
+	if !ok || now.After(usage.reset) {
+		usage = &keyUsage{reset: now.Add(server.Options.QuotaPeriod)}
+		server.usage[key] = usage
+	}
+	header := writer.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(server.Options.Quota))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(usage.reset.Unix(), 10))
+	if usage.used >= server.Options.Quota {
+		header.Set("X-RateLimit-Remaining", "0")
+		header.Set("Retry-After", strconv.Itoa(int(usage.reset.Sub(now).Seconds())+1))
+		writeError(writer, http.StatusTooManyRequests, "RATE_LIMIT_EXCEEDED", "Quota Exceeded")
+		return false
+	}
+	usage.used++
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(server.Options.Quota-usage.used))
+	return true
+}
+
+func (server *Server) search(writer http.ResponseWriter, request *http.Request) {
+	var entries []json.RawMessage
+	data, err := ioutil.ReadFile(filepath.Join(server.Fixtures, "search.json"))
+	if err != nil && !os.IsNotExist(err) {
+		writeError(writer, http.StatusInternalServerError, "GENERAL_SYSTEM_ERROR", err.Error())
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &entries)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, "GENERAL_SYSTEM_ERROR", err.Error())
+			return
+		}
+	}
+	query := request.URL.Query()
+	start, err := intParam(query.Get("start"), 0)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "INVALID_INPUT", "Invalid start value")
+		return
+	}
+	count, err := intParam(query.Get("count"), defaultCount)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "INVALID_INPUT", "Invalid count value")
+		return
+	}
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		if query.Get("start") != "" {
+			writeError(writer, http.StatusBadRequest, "INVALID_INPUT", "Cursor and start can not be used together")
+			return
+		}
+		start, err = decodeCursor(cursor)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "INVALID_INPUT", "Invalid cursor value")
+			return
+		}
+	} else if start+count > maxSearchResults {
+		writeError(writer, http.StatusBadRequest, "INVALID_INPUT",
+			"Exceeds the maximum number allowed for the service level")
+		return
+	}
+	page := []json.RawMessage{}
+	for i := start; i < start+count && i < len(entries); i++ {
+		page = append(page, entries[i])
+	}
+	results := map[string]interface{}{
+		"opensearch:totalResults": strconv.Itoa(len(entries)),
+		"opensearch:startIndex":   strconv.Itoa(start),
+		"opensearch:itemsPerPage": strconv.Itoa(len(page)),
+		"entry":                   page,
+	}
+	if cursor != "" {
+		results["cursor"] = map[string]string{"@current": cursor, "@next": encodeCursor(start + count)}
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"search-results": results})
+}
+
+// encodeCursor makes an opaque cursor for the offset, it contains the
+// characters which have to be escaped like the real ones
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "*" {
+		return 0, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimPrefix(string(data), "offset:"))
+}
+
+func (server *Server) serveFile(writer http.ResponseWriter, kind string, id string) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		writeError(writer, http.StatusBadRequest, "INVALID_INPUT", "Invalid identifier "+id)
+		return
+	}
+	data, err := ioutil.ReadFile(filepath.Join(server.Fixtures, kind, id+".json"))
+	if os.IsNotExist(err) {
+		writeError(writer, http.StatusNotFound, "RESOURCE_NOT_FOUND",
+			"The resource specified cannot be found.")
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, "GENERAL_SYSTEM_ERROR", err.Error())
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(data)
+}
+
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func contains(slice []string, elem string) bool {
+	for _, el := range slice {
+		if el == elem {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError answers in the format of the Elsevier service errors
+func writeError(writer http.ResponseWriter, status int, code string, text string) {
+	writeJSON(writer, status, map[string]interface{}{
+		"service-error": map[string]interface{}{
+			"status": map[string]string{
+				"statusCode": code,
+				"statusText": text,
+			},
+		},
+	})
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
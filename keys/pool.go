@@ -0,0 +1,272 @@
+package keys
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"../ratelimit"
+)
+
+const (
+	KeyActive    = "active"
+	KeyThrottled = "throttled"
+	KeyInvalid   = "invalid"
+)
+
+// defaultPark is used when a throttled response has no reset time
+const defaultPark = time.Minute
+
+// ErrNoKeys is returned when every key of the pool is invalid
+var ErrNoKeys = errors.New("no valid API keys left")
+
+// KeyStats describes the usage of a key
+type KeyStats struct {
+	Key       string    `json:"key"`
+	State     string    `json:"state"`
+	Requests  int       `json:"requests"`
+	Throttled int       `json:"throttled"`
+	Errors    int       `json:"errors"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	LastUsed  time.Time `json:"lastUsed"`
+}
+
+type apiKey struct {
+	value string
+	stats KeyStats
+	// buckets limit the requests made with the key by the data source address
+	buckets map[string]*ratelimit.Bucket
+}
+
+// Pool shares the Elsevier API keys between all workers. Keys are picked by
+// the quota left, throttled keys are parked until their quota resets and
+// rejected keys are never used again. Elsevier limits the rate of every key
+// for every API, so each key has a rate limit for each data source.
+type Pool struct {
+	mutex sync.Mutex
+	keys  []*apiKey
+	rates map[string]float64
+}
+
+func NewPool(values []string) *Pool {
+	pool := &Pool{rates: map[string]float64{}}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		pool.keys = append(pool.keys, &apiKey{
+			value:   value,
+			stats:   KeyStats{Key: mask(value), State: KeyActive, Remaining: -1},
+			buckets: map[string]*ratelimit.Bucket{},
+		})
+	}
+	return pool
+}
+
+// Load reads the keys from a file, one key per line
+func Load(path string) (*Pool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewPool(lines), nil
+}
+
+// SetRateLimit limits the requests made with every key to the data source
+// address to rate per second. Data sources with the same address share the
+// lowest of their limits.
+func (pool *Pool) SetRateLimit(address string, rate float64) {
+	if rate <= 0 {
+		return
+	}
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if current, ok := pool.rates[address]; ok && current <= rate {
+		return
+	}
+	pool.rates[address] = rate
+	for _, key := range pool.keys {
+		delete(key.buckets, address)
+	}
+}
+
+// bucket returns the rate limit of the key for the data source address
+func (pool *Pool) bucket(key *apiKey, address string) *ratelimit.Bucket {
+	bucket, ok := key.buckets[address]
+	if !ok {
+		bucket = ratelimit.NewBucket(pool.rates[address], 1)
+		key.buckets[address] = bucket
+	}
+	return bucket
+}
+
+// Acquire returns the key with the largest quota left for a request to the
+// data source address once the rate limit of the key allows it. When all
+// keys are throttled it waits for the first of them to reset.
+func (pool *Pool) Acquire(address string) (string, error) {
+	for {
+		key, delay, wait, err := pool.tryAcquire(address)
+		if err != nil {
+			return "", err
+		}
+		if key != "" {
+			time.Sleep(delay)
+			return key, nil
+		}
+		time.Sleep(wait)
+	}
+}
+
+// tryAcquire picks the key and reserves its rate limit token, the caller
+// waits for the returned delay before the request. Keys with a free token go
+// first, so concurrent requests are spread over the keys. The reserved
+// requests are taken off the quota left until the responses report it. When
+// no key is active the wait for the first throttled one is returned.
+func (pool *Pool) tryAcquire(address string) (string, time.Duration, time.Duration, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	now := time.Now()
+	var best *apiKey
+	var bestDelay, wait time.Duration
+	for _, key := range pool.keys {
+		if key.stats.State == KeyThrottled && !now.Before(key.stats.Reset) {
+			key.stats.State = KeyActive
+			key.stats.Remaining = -1
+		}
+		switch key.stats.State {
+		case KeyActive:
+			delay := pool.bucket(key, address).Delay()
+			if best == nil || delay < bestDelay || (delay == bestDelay && better(key.stats, best.stats)) {
+				best, bestDelay = key, delay
+			}
+		case KeyThrottled:
+			if left := key.stats.Reset.Sub(now); wait == 0 || left < wait {
+				wait = left
+			}
+		}
+	}
+	if best != nil {
+		best.stats.Requests++
+		best.stats.LastUsed = now
+		if best.stats.Remaining > 0 {
+			best.stats.Remaining--
+		}
+		return best.value, pool.bucket(best, address).Reserve(), 0, nil
+	}
+	if wait == 0 {
+		return "", 0, 0, ErrNoKeys
+	}
+	return "", 0, wait, nil
+}
+
+// better prefers keys with more quota left, unknown quota counts as the most,
+// then the less used ones
+func better(a KeyStats, b KeyStats) bool {
+	if a.Remaining != b.Remaining {
+		if a.Remaining < 0 {
+			return true
+		}
+		if b.Remaining < 0 {
+			return false
+		}
+		return a.Remaining > b.Remaining
+	}
+	return a.Requests < b.Requests
+}
+
+// Report updates the key state from the response to a request made with it.
+// Network errors are counted but do not affect the key.
+func (pool *Pool) Report(value string, resp *http.Response, err error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	key := pool.find(value)
+	if key == nil {
+		return
+	}
+	if err != nil || resp == nil {
+		key.stats.Errors++
+		return
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		key.stats.Remaining = remaining
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		key.stats.Reset = time.Unix(reset, 0)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		key.stats.State = KeyInvalid
+	case resp.StatusCode == http.StatusTooManyRequests:
+		key.stats.Throttled++
+		key.park(resp)
+	case key.stats.Remaining == 0:
+		key.park(resp)
+	}
+}
+
+// park makes the key unavailable until its quota resets
+func (key *apiKey) park(resp *http.Response) {
+	now := time.Now()
+	key.stats.State = KeyThrottled
+	if key.stats.Reset.After(now) {
+		return
+	}
+	key.stats.Reset = now.Add(defaultPark)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		key.stats.Reset = now.Add(time.Duration(seconds) * time.Second)
+	}
+}
+
+func (pool *Pool) find(value string) *apiKey {
+	for _, key := range pool.keys {
+		if key.value == value {
+			return key
+		}
+	}
+	return nil
+}
+
+// Stats returns the usage of every key, the keys themselves are masked
+func (pool *Pool) Stats() []KeyStats {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	stats := make([]KeyStats, len(pool.keys))
+	for i, key := range pool.keys {
+		stats[i] = key.stats
+	}
+	return stats
+}
+
+// Redact hides the keys of the pool in the text, e.g. in error messages with request URLs
+func (pool *Pool) Redact(text string) string {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	for _, key := range pool.keys {
+		text = strings.Replace(text, key.value, key.stats.Key, -1)
+	}
+	return text
+}
+
+func mask(value string) string {
+	if len(value) <= 8 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:4] + strings.Repeat("*", len(value)-8) + value[len(value)-4:]
+}
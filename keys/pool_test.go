@@ -0,0 +1,81 @@
+package keys
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitPerKeyAndSource(t *testing.T) {
+	pool := NewPool([]string{"key-1"})
+	pool.SetRateLimit("search", 1)
+	pool.SetRateLimit("abstract", 1)
+	pool.SetRateLimit("search", 5)
+	steps := []struct {
+		address string
+		delayed bool
+	}{
+		{"search", false},
+		// the abstract limit of the key is apart from its search limit
+		{"abstract", false},
+		{"search", true},
+		{"abstract", true},
+		// data sources without a limit are not delayed
+		{"author", false},
+		{"author", false},
+	}
+	for i, step := range steps {
+		key, delay, _, err := pool.tryAcquire(step.address)
+		if err != nil || key != "key-1" {
+			t.Fatalf("step %d: %q, %v", i, key, err)
+		}
+		// the lowest rate of the address is kept, a token takes a second
+		if step.delayed != (delay > 500*time.Millisecond) {
+			t.Errorf("step %d: %s delayed for %v", i, step.address, delay)
+		}
+	}
+}
+
+func TestRateLimitAddsUpOverKeys(t *testing.T) {
+	pool := NewPool([]string{"key-1", "key-2", "key-3"})
+	pool.SetRateLimit("search", 1)
+	used := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		key, delay, _, err := pool.tryAcquire("search")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delay > 0 {
+			t.Errorf("request %d with %s is delayed for %v", i, key, delay)
+		}
+		used[key] = true
+	}
+	if len(used) != 3 {
+		t.Errorf("keys used %v", used)
+	}
+}
+
+func TestAcquireCountsReservedRequests(t *testing.T) {
+	pool := NewPool([]string{"key-1", "key-2"})
+	for key, remaining := range map[string]string{"key-1": "10", "key-2": "9"} {
+		header := http.Header{}
+		header.Set("X-RateLimit-Remaining", remaining)
+		pool.Report(key, &http.Response{StatusCode: http.StatusOK, Header: header}, nil)
+	}
+	var used []string
+	for i := 0; i < 4; i++ {
+		key, err := pool.Acquire("search")
+		if err != nil {
+			t.Fatal(err)
+		}
+		used = append(used, key)
+	}
+	if strings.Join(used, " ") != "key-1 key-2 key-1 key-2" {
+		t.Errorf("keys used %v", used)
+	}
+	stats := pool.Stats()
+	if stats[0].Remaining != 8 || stats[1].Remaining != 7 {
+		t.Errorf("quota left %d and %d, want 8 and 7", stats[0].Remaining, stats[1].Remaining)
+	}
+}
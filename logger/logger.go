@@ -8,9 +8,10 @@ import (
 	"../config"
 )
 
+// The loggers write to the standard output until Init is called
 var (
-	Trace *log.Logger
-	Error *log.Logger
+	Trace = log.New(os.Stdout, "[TRACE]: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Error = log.New(os.Stdout, "[ERROR]: ", log.Ldate|log.Ltime|log.Lshortfile)
 )
 
 func Init() error {
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"./config"
 	"./crawler"
+	"./keys"
 	"./logger"
+	"./query"
 	"./storage"
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
@@ -21,21 +24,42 @@ func main() {
 		return
 	}
 	conf, _ := config.ReadConfig("config.json")
-	Storage := storage.MySqlStorage{
-		DBType:   storage.MYSQL,
-		User:     conf.Mysqluser,
-		Password: conf.Mysqlpass,
-		Address:  conf.Mysqladdress,
-		DbName:   conf.Mysqldbname}
+	Storage, err := storage.NewStorage(conf)
+	if err != nil {
+		logger.Error.Println(err)
+		return
+	}
 	err = Storage.Init()
 	if err != nil {
 		logger.Error.Println(err)
+		return
+	}
+	query.Keys, err = keys.Load("keys.txt")
+	if err != nil {
+		logger.Error.Println(err)
+		return
 	}
 	manager := crawler.Manager{}
 	manager.Storage = Storage
-	manager.Init("data-sources.json", conf.WorkersNumber)
+	manager.ApiURL = conf.ApiURL
+	if conf.BatchSize > 1 {
+		interval := time.Duration(conf.BatchInterval * float64(time.Second))
+		manager.Batcher = storage.NewArticleBatcher(Storage, conf.BatchSize, interval)
+	}
+	err = manager.Init("data-sources.json", conf.WorkersNumber)
+	if err != nil {
+		logger.Error.Println(err)
+		return
+	}
 	router := mux.NewRouter()
 	router.HandleFunc("/request", RequestHandler(&manager))
+	router.HandleFunc("/jobs/{id}", JobHandler(&manager)).Methods("GET")
+	router.HandleFunc("/keys", KeysHandler(query.Keys)).Methods("GET")
+	router.HandleFunc("/failed", FailedRequestsHandler(Storage)).Methods("GET")
+	router.HandleFunc("/search/{table}", SearchHandler(Storage)).Methods("POST")
+	if memoryStorage, ok := Storage.(*storage.MemoryStorage); ok {
+		router.HandleFunc("/dump", DumpHandler(memoryStorage)).Methods("GET")
+	}
 	n := negroni.Classic()
 	n.UseHandler(router)
 	http.ListenAndServe(":9000", n)
@@ -56,10 +80,133 @@ func RequestHandler(manager *crawler.Manager) http.HandlerFunc {
 	fn := func(writer http.ResponseWriter, request *http.Request) {
 		searchRequest, err := readRequest(request.Body)
 		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		job, err := manager.StartCrawling(searchRequest)
+		if crawler.IsInvalidRequest(err) {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error.Println(err)
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(writer, job)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func JobHandler(manager *crawler.Manager) http.HandlerFunc {
+	fn := func(writer http.ResponseWriter, request *http.Request) {
+		id := mux.Vars(request)["id"]
+		job, err := manager.GetJob(id)
+		if err == storage.ErrNotFound {
+			http.Error(writer, "job "+id+" was not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error.Println(err)
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(writer, job)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// KeysHandler shows the usage and state of every API key
+func KeysHandler(pool *keys.Pool) http.HandlerFunc {
+	fn := func(writer http.ResponseWriter, request *http.Request) {
+		writeJSON(writer, pool.Stats())
+	}
+	return http.HandlerFunc(fn)
+}
+
+// FailedRequestsHandler lists the requests that failed after all retries
+func FailedRequestsHandler(Storage storage.GenericStorage) http.HandlerFunc {
+	fn := func(writer http.ResponseWriter, request *http.Request) {
+		requests, err := Storage.GetFailedRequests()
+		if err != nil {
+			logger.Error.Println(err)
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(writer, requests)
+	}
+	return http.HandlerFunc(fn)
+}
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// SearchHandler searches the table in the path with the storage.Filter in the
+// request body. Results are paged, defaultSearchLimit records at a time.
+func SearchHandler(Storage storage.GenericStorage) http.HandlerFunc {
+	fn := func(writer http.ResponseWriter, request *http.Request) {
+		table := mux.Vars(request)["table"]
+		var filter storage.Filter
+		decoder := json.NewDecoder(request.Body)
+		decoder.UseNumber()
+		err := decoder.Decode(&filter)
+		if err != nil && err != io.EOF {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if filter.Limit == 0 {
+			filter.Limit = defaultSearchLimit
+		}
+		if filter.Limit > maxSearchLimit {
+			filter.Limit = maxSearchLimit
+		}
+		err = filter.Validate(table)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result interface{}
+		switch table {
+		case "articles":
+			result, err = Storage.SearchArticles(filter)
+		case "authors":
+			result, err = Storage.SearchAuthors(filter)
+		case "affiliations":
+			result, err = Storage.SearchAffiliations(filter)
+		case "keywords":
+			result, err = Storage.SearchKeywords(filter)
+		case "subject_areas":
+			result, err = Storage.SearchSubjectAreas(filter)
+		}
+		if err != nil {
+			logger.Error.Println(err)
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(writer, result)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func writeJSON(writer http.ResponseWriter, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(writer).Encode(value)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+// DumpHandler shows what a dry run crawl has written so far
+func DumpHandler(memoryStorage *storage.MemoryStorage) http.HandlerFunc {
+	fn := func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		err := memoryStorage.Dump(writer)
+		if err != nil {
+			logger.Error.Println(err)
 		}
-		writer.WriteHeader(http.StatusOK)
-		manager.StartCrawling(searchRequest)
 	}
 	return http.HandlerFunc(fn)
 }
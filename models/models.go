@@ -8,6 +8,15 @@ type Author struct {
 	Name          string
 	AffiliationID []string
 	Affiliation   Affiliation
+	// Profile of the author from the Author Retrieval API
+	HIndex             int
+	DocumentCount      int
+	CitedByCount       int
+	CitationCount      int
+	Orcid              string
+	NameVariants       []string
+	SubjectAreas       []SubjectArea
+	AffiliationHistory []string
 }
 
 type Affiliation struct {
@@ -27,7 +36,7 @@ type Article struct {
 	PublicationDate  string        `json:"prism:coverDate"`
 	CitationsCount   int           `json:"citedby-count"`
 	PublicationType  string        `json:"prism:aggregationType"`
-	PublicationTitle string        `json:"prism:coverDate"`
+	PublicationTitle string        `json:"prism:publicationName"`
 	Doi              string        `json:"prism:doi"`
 	Affiliations     []Affiliation `json:"affiliation"`
 	Authors          []Author      `json:"authors"`
@@ -37,7 +46,7 @@ type Article struct {
 }
 
 type SubjectArea struct {
-	ScopusID    string `json:"@code"`
+	ScopusID    string `json:"id"`
 	Title       string `json:"@abbrev"`
 	Code        string `json:"@code"`
 	Description string `json:"@_fa"`
@@ -47,3 +56,84 @@ type Keyword struct {
 	ID    string
 	Value string
 }
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// JobProgress holds the counters of a crawl job. When passed to the storage
+// the values are treated as increments.
+type JobProgress struct {
+	PagesPlanned    int    `json:"pagesPlanned"`
+	ArticlesFetched int    `json:"articlesFetched"`
+	ArticlesStored  int    `json:"articlesStored"`
+	Errors          int    `json:"errors"`
+	LastError       string `json:"lastError,omitempty"`
+}
+
+// Job is a crawl started by a single request to the crawler
+type Job struct {
+	ID         string            `json:"id"`
+	SourceName string            `json:"sourceName"`
+	Fields     map[string]string `json:"fields"`
+	State      string            `json:"state"`
+	// PendingTasks is the number of queued and running tasks of the job
+	PendingTasks int   `json:"pendingTasks"`
+	CreatedAt    int64 `json:"createdAt"`
+	UpdatedAt    int64 `json:"updatedAt"`
+	JobProgress
+	// Splits is the tree of the searches the job was split into
+	Splits []JobSplit `json:"splits,omitempty"`
+}
+
+// JobSplit is a search planned by a job. Searches with more results than
+// Scopus returns are split into narrower ones, their children.
+type JobSplit struct {
+	ID           string            `json:"id"`
+	JobID        string            `json:"-"`
+	ParentID     string            `json:"parentId,omitempty"`
+	Fields       map[string]string `json:"fields"`
+	TotalResults int               `json:"totalResults"`
+	SplitBy      string            `json:"splitBy,omitempty"`
+	Pages        int               `json:"pages"`
+	// Truncated is set when the search could not be split enough to get all of its results
+	Truncated bool `json:"truncated,omitempty"`
+	// CreatedAt orders the splits, in nanoseconds
+	CreatedAt int64      `json:"-"`
+	Children  []JobSplit `json:"children,omitempty"`
+}
+
+// FailedRequest is a request to the data source that failed for good
+type FailedRequest struct {
+	Request   string `json:"request"`
+	Kind      string `json:"kind"`
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+	Attempts  int    `json:"attempts"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+const (
+	TaskPending = "pending"
+	TaskLeased  = "leased"
+	TaskDone    = "done"
+	TaskFailed  = "failed"
+)
+
+// Task is a unit of crawl work persisted in the storage queue
+type Task struct {
+	ID          int64
+	Key         string
+	JobID       string
+	SourceName  string
+	ScopusID    string
+	Fields      map[string]string
+	State       string
+	Attempts    int
+	BypassCache bool
+	// Depth is the distance from the article found by the job search in the references graph
+	Depth int
+}
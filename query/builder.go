@@ -0,0 +1,219 @@
+package query
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Fields of the Scopus advanced search supported by Query
+const (
+	TitleAbsKey   = "TITLE-ABS-KEY"
+	AuthorName    = "AUTHOR-NAME"
+	AffiliationID = "AFFILID"
+	PubYear       = "PUBYEAR"
+	SubjectArea   = "SUBJAREA"
+	DocType       = "DOCTYPE"
+)
+
+// SubjectAreas are the codes of the Scopus subject areas
+var SubjectAreas = []string{"AGRI", "ARTS", "BIOC", "BUSI", "CENG", "CHEM", "COMP", "DECI", "DENT", "EART",
+	"ECON", "ENER", "ENGI", "ENVI", "HEAL", "IMMU", "MATE", "MATH", "MEDI", "MULT", "NEUR", "NURS", "PHAR",
+	"PHYS", "PSYC", "SOCI", "VETE"}
+
+// DocTypes are the codes of the Scopus document types
+var DocTypes = []string{"ar", "ab", "bk", "bz", "ch", "cp", "cr", "dp", "ed", "er", "le", "no", "pr", "re",
+	"sh", "tb"}
+
+// yearComparisons are the operators PUBYEAR can be compared with
+var yearComparisons = []string{"", "=", "IS", "AFT", "BEF", ">", "<"}
+
+// Query is a Scopus advanced search query. A query is either a field
+// condition, e.g. {"field": "PUBYEAR", "compare": "AFT", "value": "2010"},
+// or a group of queries: {"and": [...]}, {"or": [...]}. Negated queries,
+// {"not": {...}}, are only allowed in the and groups.
+type Query struct {
+	Field   string  `json:"field,omitempty"`
+	Compare string  `json:"compare,omitempty"`
+	Value   string  `json:"value,omitempty"`
+	And     []Query `json:"and,omitempty"`
+	Or      []Query `json:"or,omitempty"`
+	Not     *Query  `json:"not,omitempty"`
+}
+
+func Term(field string, value string) Query {
+	return Query{Field: field, Value: value}
+}
+
+func Year(compare string, year int) Query {
+	return Query{Field: PubYear, Compare: compare, Value: strconv.Itoa(year)}
+}
+
+func And(queries ...Query) Query {
+	return Query{And: queries}
+}
+
+func Or(queries ...Query) Query {
+	return Query{Or: queries}
+}
+
+func Not(query Query) Query {
+	return Query{Not: &query}
+}
+
+// String renders the query, it returns an error if the query is not valid
+func (query Query) String() (string, error) {
+	if query.Not != nil {
+		return "", errors.New("not has to be a part of an and group")
+	}
+	return query.render()
+}
+
+func (query Query) render() (string, error) {
+	kinds := 0
+	if query.Field != "" {
+		kinds++
+	}
+	if len(query.And) > 0 {
+		kinds++
+	}
+	if len(query.Or) > 0 {
+		kinds++
+	}
+	if query.Not != nil {
+		kinds++
+	}
+	if kinds != 1 {
+		return "", errors.New("query has to be exactly one of a field condition, and, or, not")
+	}
+	switch {
+	case query.Field != "":
+		return query.renderField()
+	case query.Not != nil:
+		if query.Not.Not != nil {
+			return "", errors.New("double negation in the query")
+		}
+		return query.Not.render()
+	case len(query.And) > 0:
+		return renderGroup(query.And, "AND")
+	default:
+		return renderGroup(query.Or, "OR")
+	}
+}
+
+func renderGroup(queries []Query, operator string) (string, error) {
+	var result string
+	for i, item := range queries {
+		part, err := item.render()
+		if err != nil {
+			return "", err
+		}
+		if len(item.And) > 0 || len(item.Or) > 0 || (item.Not != nil && item.Not.Field == "") {
+			part = "(" + part + ")"
+		}
+		switch {
+		case item.Not != nil && (operator != "AND" || i == 0):
+			return "", errors.New("not has to follow another condition of an and group")
+		case item.Not != nil:
+			result += " AND NOT " + part
+		case i == 0:
+			result = part
+		default:
+			result += " " + operator + " " + part
+		}
+	}
+	return result, nil
+}
+
+func (query Query) renderField() (string, error) {
+	value := strings.TrimSpace(query.Value)
+	if value == "" {
+		return "", errors.New("empty value of " + query.Field)
+	}
+	if strings.ContainsAny(value, `"{}()`) {
+		return "", errors.New("value of " + query.Field + " contains quotes or brackets: " + value)
+	}
+	if query.Compare != "" && query.Field != PubYear {
+		return "", errors.New("compare is only supported for " + PubYear)
+	}
+	switch query.Field {
+	case TitleAbsKey, AuthorName:
+		if strings.ContainsAny(value, " ,") {
+			value = `"` + value + `"`
+		}
+	case AffiliationID:
+		if !isDigits(value) {
+			return "", errors.New("affiliation id has to be a number: " + value)
+		}
+	case PubYear:
+		if len(value) != 4 || !isDigits(value) {
+			return "", errors.New("publication year has to be a four digit number: " + value)
+		}
+		compare := strings.ToUpper(query.Compare)
+		if !contains(yearComparisons, compare) {
+			return "", errors.New("unknown comparison of " + PubYear + ": " + query.Compare)
+		}
+		if compare == "" {
+			compare = "IS"
+		}
+		return PubYear + " " + compare + " " + value, nil
+	case SubjectArea:
+		value = strings.ToUpper(value)
+		if !contains(SubjectAreas, value) {
+			return "", errors.New("unknown subject area: " + value)
+		}
+	case DocType:
+		value = strings.ToLower(value)
+		if !contains(DocTypes, value) {
+			return "", errors.New("unknown document type: " + value)
+		}
+	default:
+		return "", errors.New("unsupported query field: " + query.Field)
+	}
+	return query.Field + "(" + value + ")", nil
+}
+
+// CheckQuery looks for unbalanced brackets and quotes in a raw query
+func CheckQuery(raw string) error {
+	depth := 0
+	quoted := false
+	for _, char := range raw {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case quoted:
+		case char == '(':
+			depth++
+		case char == ')':
+			depth--
+			if depth < 0 {
+				return errors.New("unbalanced brackets in the query: " + raw)
+			}
+		}
+	}
+	if depth != 0 {
+		return errors.New("unbalanced brackets in the query: " + raw)
+	}
+	if quoted {
+		return errors.New("unbalanced quotes in the query: " + raw)
+	}
+	return nil
+}
+
+func isDigits(value string) bool {
+	for _, char := range value {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package query
+
+import "testing"
+
+func TestQueryString(t *testing.T) {
+	graph := Term(TitleAbsKey, "graph")
+	tree := Term(TitleAbsKey, "tree")
+	comp := Term(SubjectArea, "COMP")
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"term", graph, "TITLE-ABS-KEY(graph)"},
+		{"trimmed value", Term(TitleAbsKey, "  graph "), "TITLE-ABS-KEY(graph)"},
+		{"phrase is quoted", Term(TitleAbsKey, "neural network"), `TITLE-ABS-KEY("neural network")`},
+		{"comma is quoted", Term(AuthorName, "Ivanov,A"), `AUTHOR-NAME("Ivanov,A")`},
+		{"author name", Term(AuthorName, "Ivanov A."), `AUTHOR-NAME("Ivanov A.")`},
+		{"affiliation", Term(AffiliationID, "60000001"), "AFFILID(60000001)"},
+		{"subject area upper case", Term(SubjectArea, "comp"), "SUBJAREA(COMP)"},
+		{"document type lower case", Term(DocType, "AR"), "DOCTYPE(ar)"},
+		{"year", Year("", 2010), "PUBYEAR IS 2010"},
+		{"year after", Year("aft", 2010), "PUBYEAR AFT 2010"},
+		{"year less", Year("<", 2010), "PUBYEAR < 2010"},
+		{"and", And(graph, comp), "TITLE-ABS-KEY(graph) AND SUBJAREA(COMP)"},
+		{"or", Or(graph, tree), "TITLE-ABS-KEY(graph) OR TITLE-ABS-KEY(tree)"},
+		{"single item group", And(graph), "TITLE-ABS-KEY(graph)"},
+		{"or within and", And(comp, Or(graph, tree)),
+			"SUBJAREA(COMP) AND (TITLE-ABS-KEY(graph) OR TITLE-ABS-KEY(tree))"},
+		{"and within or", Or(And(graph, comp), tree),
+			"(TITLE-ABS-KEY(graph) AND SUBJAREA(COMP)) OR TITLE-ABS-KEY(tree)"},
+		{"not", And(graph, Not(tree)), "TITLE-ABS-KEY(graph) AND NOT TITLE-ABS-KEY(tree)"},
+		{"not of a group", And(comp, Not(Or(graph, tree))),
+			"SUBJAREA(COMP) AND NOT (TITLE-ABS-KEY(graph) OR TITLE-ABS-KEY(tree))"},
+		{"not of an and group", And(comp, Not(And(graph, tree))),
+			"SUBJAREA(COMP) AND NOT (TITLE-ABS-KEY(graph) AND TITLE-ABS-KEY(tree))"},
+		{"not in the middle", And(graph, Not(tree), Year("AFT", 2010)),
+			"TITLE-ABS-KEY(graph) AND NOT TITLE-ABS-KEY(tree) AND PUBYEAR AFT 2010"},
+		{"not within a nested and", Or(And(graph, Not(tree)), comp),
+			"(TITLE-ABS-KEY(graph) AND NOT TITLE-ABS-KEY(tree)) OR SUBJAREA(COMP)"},
+	}
+	for _, test := range tests {
+		got, err := test.query.String()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if err = CheckQuery(got); err != nil {
+			t.Errorf("%s: rendered query is not balanced: %v", test.name, err)
+		}
+	}
+}
+
+func TestQueryStringRejected(t *testing.T) {
+	graph := Term(TitleAbsKey, "graph")
+	tree := Term(TitleAbsKey, "tree")
+	tests := []struct {
+		name  string
+		query Query
+	}{
+		{"empty query", Query{}},
+		{"field and group", Query{Field: TitleAbsKey, Value: "graph", And: []Query{tree}}},
+		{"and and or", Query{And: []Query{graph}, Or: []Query{tree}}},
+		{"top level not", Not(graph)},
+		{"not in an or group", Or(graph, Not(tree))},
+		{"not first in an and group", And(Not(graph), tree)},
+		{"only not in an and group", And(Not(graph))},
+		{"double negation", And(graph, Not(Not(tree)))},
+		{"invalid item of a group", And(graph, Term(TitleAbsKey, ""))},
+		{"empty value", Term(TitleAbsKey, "  ")},
+		{"quote in a value", Term(TitleAbsKey, `graph"`)},
+		{"closing bracket in a value", Term(TitleAbsKey, "graph) OR ALL(x")},
+		{"opening bracket in a value", Term(AuthorName, "Ivanov (A)")},
+		{"brace in a value", Term(TitleAbsKey, "{graph}")},
+		{"compare of a term", Query{Field: TitleAbsKey, Compare: "AFT", Value: "graph"}},
+		{"affiliation id", Term(AffiliationID, "60000001 OR 1")},
+		{"short year", Query{Field: PubYear, Value: "201"}},
+		{"year with letters", Query{Field: PubYear, Value: "20x0"}},
+		{"unknown comparison", Year("SINCE", 2010)},
+		{"unknown subject area", Term(SubjectArea, "MAGI")},
+		{"unknown document type", Term(DocType, "xx")},
+		{"unsupported field", Term("ALL", "graph")},
+	}
+	for _, test := range tests {
+		if got, err := test.query.String(); err == nil {
+			t.Errorf("%s: rendered %q", test.name, got)
+		}
+	}
+}
+
+func TestCheckQuery(t *testing.T) {
+	tests := []struct {
+		raw   string
+		valid bool
+	}{
+		{"", true},
+		{"TITLE(graph)", true},
+		{"TITLE(graph) AND (PUBYEAR > 2010 OR SUBJAREA(COMP))", true},
+		{`TITLE("graph (theory")`, true},
+		{`TITLE("graph) OR ALL(x")`, true},
+		{"TITLE(100% renewable)", true},
+		{"TITLE(graph", false},
+		{"TITLE(graph))", false},
+		{")TITLE(graph(", false},
+		{`TITLE("graph)`, false},
+		{`TITLE("graph) AND "x"`, false},
+	}
+	for _, test := range tests {
+		err := CheckQuery(test.raw)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: %v, want valid %v", test.raw, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package query
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of the errors returned by MakeQuery
+const (
+	ErrorAuth       = "auth"
+	ErrorThrottled  = "throttled"
+	ErrorNotFound   = "not found"
+	ErrorServer     = "server"
+	ErrorNetwork    = "network"
+	ErrorBadRequest = "bad request"
+)
+
+const (
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = 1.0
+	maxRetryDelay         = time.Minute
+)
+
+// Error describes a failed request to the data source. Request never
+// contains the apiKey.
+type Error struct {
+	Kind    string
+	Status  int
+	Request string
+	Message string
+	// RetryAfter is the delay asked by the data source, if any
+	RetryAfter time.Duration
+}
+
+func (err *Error) Error() string {
+	message := err.Kind + " error"
+	if err.Status != 0 {
+		message += " (" + strconv.Itoa(err.Status) + ")"
+	}
+	message += " requesting " + err.Request
+	if err.Message != "" {
+		message += ": " + err.Message
+	}
+	return message
+}
+
+// Temporary reports whether repeating the request may succeed. A rejected key
+// is temporary too, as the next attempt is made with another one.
+func (err *Error) Temporary() bool {
+	switch err.Kind {
+	case ErrorAuth:
+		return err.Status == http.StatusUnauthorized
+	case ErrorThrottled, ErrorServer, ErrorNetwork:
+		return true
+	}
+	return false
+}
+
+// IsNotFound reports whether the requested entity does not exist in the data source
+func IsNotFound(err error) bool {
+	queryErr, ok := err.(*Error)
+	return ok && queryErr.Kind == ErrorNotFound
+}
+
+// statusError classifies the response status, it returns nil for successful responses
+func statusError(request string, status int, header http.Header, body string) *Error {
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	err := &Error{Status: status, Request: request, Message: errorMessage(body)}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		err.Kind = ErrorAuth
+	case status == http.StatusTooManyRequests:
+		err.Kind = ErrorThrottled
+	case status == http.StatusNotFound:
+		err.Kind = ErrorNotFound
+	case status >= 500:
+		err.Kind = ErrorServer
+	default:
+		err.Kind = ErrorBadRequest
+	}
+	if seconds, parseErr := strconv.Atoi(header.Get("Retry-After")); parseErr == nil {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return err
+}
+
+// errorMessage shortens the error page of the data source
+func errorMessage(body string) string {
+	body = strings.TrimSpace(body)
+	if len(body) > 200 {
+		return body[:200] + "..."
+	}
+	return body
+}
+
+// backoff returns the delay before the retry after the given number of
+// failed attempts, exponential with jitter, but not shorter than asked by the
+// data source
+func backoff(attempt int, baseDelay float64, err *Error) time.Duration {
+	delay := time.Duration(baseDelay * float64(time.Second))
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	if err.RetryAfter > delay {
+		return err.RetryAfter
+	}
+	return delay
+}
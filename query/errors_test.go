@@ -0,0 +1,135 @@
+package query
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		kind       string
+		temporary  bool
+		wait       time.Duration
+	}{
+		{"ok", http.StatusOK, "", "", false, 0},
+		{"no content", http.StatusNoContent, "", "", false, 0},
+		{"rejected key", http.StatusUnauthorized, "", ErrorAuth, true, 0},
+		{"forbidden", http.StatusForbidden, "", ErrorAuth, false, 0},
+		{"not found", http.StatusNotFound, "", ErrorNotFound, false, 0},
+		{"throttled", http.StatusTooManyRequests, "30", ErrorThrottled, true, 30 * time.Second},
+		{"throttled until a date", http.StatusTooManyRequests, "Wed, 21 Oct 2026 07:28:00 GMT", ErrorThrottled,
+			true, 0},
+		{"bad request", http.StatusBadRequest, "", ErrorBadRequest, false, 0},
+		{"server error", http.StatusInternalServerError, "", ErrorServer, true, 0},
+		{"unavailable", http.StatusServiceUnavailable, "5", ErrorServer, true, 5 * time.Second},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		if test.retryAfter != "" {
+			header.Set("Retry-After", test.retryAfter)
+		}
+		err := statusError("http://api/content?id=1", test.status, header, "  failed\n")
+		if test.kind == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+			continue
+		}
+		if err.Kind != test.kind || err.Status != test.status || err.Message != "failed" {
+			t.Errorf("%s: got %+v", test.name, err)
+		}
+		if err.Temporary() != test.temporary {
+			t.Errorf("%s: temporary %v, want %v", test.name, err.Temporary(), test.temporary)
+		}
+		if err.RetryAfter != test.wait {
+			t.Errorf("%s: retry after %v, want %v", test.name, err.RetryAfter, test.wait)
+		}
+	}
+
+	// replayed responses have no header
+	err := statusError("http://api/content?id=1", http.StatusTooManyRequests, nil, "")
+	if err == nil || err.Kind != ErrorThrottled || err.RetryAfter != 0 {
+		t.Errorf("replayed response: got %+v", err)
+	}
+	err = statusError("http://api/content?id=1", http.StatusBadGateway, nil, strings.Repeat("x", 500))
+	if err == nil || len(err.Message) != 203 || !strings.HasSuffix(err.Message, "...") {
+		t.Errorf("long error page: got %+v", err)
+	}
+	want := "server error (502) requesting http://api/content?id=1: " + err.Message
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
+
+func TestErrorTemporary(t *testing.T) {
+	tests := []struct {
+		err       Error
+		temporary bool
+	}{
+		{Error{Kind: ErrorNetwork}, true},
+		{Error{Kind: ErrorNetwork, Status: http.StatusOK}, true},
+		{Error{Kind: ErrorServer, Status: http.StatusBadGateway}, true},
+		{Error{Kind: ErrorThrottled, Status: http.StatusTooManyRequests}, true},
+		{Error{Kind: ErrorAuth, Status: http.StatusUnauthorized}, true},
+		// no keys left in the pool
+		{Error{Kind: ErrorAuth}, false},
+		{Error{Kind: ErrorAuth, Status: http.StatusForbidden}, false},
+		{Error{Kind: ErrorNotFound, Status: http.StatusNotFound}, false},
+		{Error{Kind: ErrorBadRequest}, false},
+	}
+	for _, test := range tests {
+		if test.err.Temporary() != test.temporary {
+			t.Errorf("%+v: temporary %v, want %v", test.err, test.err.Temporary(), test.temporary)
+		}
+	}
+	if !IsNotFound(&Error{Kind: ErrorNotFound}) || IsNotFound(&Error{Kind: ErrorServer}) {
+		t.Error("not found errors are not told apart")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempt    int
+		baseDelay  float64
+		retryAfter time.Duration
+		min        time.Duration
+		max        time.Duration
+	}{
+		{"first retry", 1, 1, 0, 500 * time.Millisecond, time.Second},
+		{"third retry", 3, 1, 0, 2 * time.Second, 4 * time.Second},
+		{"fractional base", 2, 0.25, 0, 250 * time.Millisecond, 500 * time.Millisecond},
+		{"no base delay", 4, 0, 0, 0, 0},
+		{"capped", 10, 1, 0, maxRetryDelay / 2, maxRetryDelay},
+		{"capped large base", 1, 600, 0, maxRetryDelay / 2, maxRetryDelay},
+		{"many attempts", 1000, 1, 0, maxRetryDelay / 2, maxRetryDelay},
+		{"retry after", 1, 1, 10 * time.Second, 10 * time.Second, 10 * time.Second},
+		{"retry after over the cap", 10, 1, 2 * maxRetryDelay, 2 * maxRetryDelay, 2 * maxRetryDelay},
+		{"short retry after", 2, 1, 100 * time.Millisecond, time.Second, 2 * time.Second},
+	}
+	for _, test := range tests {
+		err := &Error{Kind: ErrorThrottled, RetryAfter: test.retryAfter}
+		delays := map[time.Duration]bool{}
+		for i := 0; i < 100; i++ {
+			delay := backoff(test.attempt, test.baseDelay, err)
+			if delay < test.min || delay > test.max {
+				t.Errorf("%s: delay %v is out of [%v, %v]", test.name, delay, test.min, test.max)
+				break
+			}
+			delays[delay] = true
+		}
+		// the delays are jittered unless the data source asks for a longer one
+		if test.min != test.max && len(delays) < 2 {
+			t.Errorf("%s: delays are not jittered: %v", test.name, delays)
+		}
+	}
+}
@@ -6,52 +6,167 @@ import (
 	"strings"
 	"time"
 
-	"fmt"
-
 	"../config"
+	"../keys"
+	"../logger"
+	"../models"
 	"../storage"
-	"net/url"
 	"crypto/tls"
+	"net/url"
 )
 
-func MakeQuery(address string, id string, params map[string]string, timeoutSec int,
-	storage storage.MySqlStorage, config config.Configuration) (string, error) {
+// Keys is the API key pool shared by all requests
+var Keys *keys.Pool
+
+// MakeQuery requests the data source with the URL escaped params. Successful
+// responses are kept in the storage and served from there until they are
+// older than config.CacheTTL seconds, unless bypassCache is set. In the record fixtures mode every
+// response is also saved to config.FixturesPath, in the replay mode responses
+// are only taken from there. Requests failed with temporary errors are
+// retried up to config.MaxRetries times, 3 if it is not set, with an
+// exponential backoff. The ones that still fail are kept in the storage as
+// failed requests. Permanent errors like a missing entity are returned at once.
+func MakeQuery(address string, id string, params map[string]string,
+	st storage.GenericStorage, config config.Configuration, bypassCache bool) (string, error) {
 	requestPath := address
 	if id != "" {
 		requestPath = strings.Replace(requestPath, "{_id_}", id, -1)
 		//requestPath = requestPath + "/" + id
 	}
 	for key, value := range params {
-		requestPath += key + "=" + value + "&"
+		requestPath += key + "=" + url.QueryEscape(value) + "&"
+	}
+	cacheKey := normalizeRequest(requestPath)
+	if config.FixturesMode == ReplayMode {
+		recording, err := LoadRecording(config.FixturesPath, cacheKey)
+		if err != nil {
+			return "", err
+		}
+		queryErr := statusError(cacheKey, recording.Status, nil, recording.Body)
+		if queryErr != nil {
+			return "", queryErr
+		}
+		return recording.Body, nil
+	}
+	maxAge := time.Duration(config.CacheTTL) * time.Second
+	if !bypassCache {
+		data, err := st.GetFinishedRequest(cacheKey, maxAge)
+		if err == nil {
+			record(config, Recording{cacheKey, http.StatusOK, data})
+			return data, nil
+		}
+		if err != storage.ErrNotFound {
+			return "", err
+		}
+	}
+	maxRetries := defaultMaxRetries
+	if config.MaxRetries != nil {
+		maxRetries = *config.MaxRetries
+	}
+	baseDelay := config.RetryBaseDelay
+	if baseDelay <= 0 {
+		baseDelay = defaultRetryBaseDelay
+	}
+	for attempt := 1; ; attempt++ {
+		data, queryErr := fetch(address, requestPath, cacheKey, config)
+		if queryErr == nil {
+			err := st.CreateFinishedRequest(cacheKey, data)
+			if err != nil {
+				logger.Error.Println(err)
+			}
+			return data, nil
+		}
+		if !queryErr.Temporary() {
+			return "", queryErr
+		}
+		if attempt > maxRetries {
+			deadLetter(st, queryErr, attempt)
+			return "", queryErr
+		}
+		delay := backoff(attempt, baseDelay, queryErr)
+		logger.Error.Println(queryErr, "- retrying in", delay)
+		time.Sleep(delay)
+	}
+}
+
+// fetch makes a single request to the data source with a key from the pool
+func fetch(address string, requestPath string, cacheKey string, config config.Configuration) (string, *Error) {
+	if Keys == nil {
+		return "", &Error{Kind: ErrorAuth, Request: cacheKey, Message: "API keys were not loaded"}
+	}
+	authKey, err := Keys.Acquire(address)
+	if err != nil {
+		return "", &Error{Kind: ErrorAuth, Request: cacheKey, Message: err.Error()}
 	}
-	var data string
-	var body []byte
-	authKey := config.GetKey()
 	requestPath = requestPath + "apiKey=" + authKey
-	fmt.Println(requestPath)
+	logger.Trace.Println(Keys.Redact(requestPath))
 	req, err := http.NewRequest("GET", requestPath, nil)
 	if err != nil {
-		return "", err
+		return "", &Error{Kind: ErrorBadRequest, Request: cacheKey, Message: Keys.Redact(err.Error())}
 	}
 	transport := &http.Transport{}
-	pr_url := &url.URL{}
-	proxyurl, _ := pr_url.Parse(config.Proxy)
-	transport.Proxy = http.ProxyURL(proxyurl)
+	if config.Proxy != "" {
+		pr_url := &url.URL{}
+		proxyurl, _ := pr_url.Parse(config.Proxy)
+		transport.Proxy = http.ProxyURL(proxyurl)
+	}
 	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //set ssl
 	client := &http.Client{}
 	client.Transport = transport
 	resp, err := client.Do(req)
+	Keys.Report(authKey, resp, err)
 	if err != nil {
-		config.RemoveKey(authKey)
-		return "", err
+		return "", &Error{Kind: ErrorNetwork, Request: cacheKey, Message: Keys.Redact(err.Error())}
 	}
 	defer resp.Body.Close()
-	body, err = ioutil.ReadAll(resp.Body)
-	data = string(body)
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return "", &Error{Kind: ErrorNetwork, Status: resp.StatusCode, Request: cacheKey, Message: err.Error()}
+	}
+	data := string(body)
+	record(config, Recording{cacheKey, resp.StatusCode, data})
+	queryErr := statusError(cacheKey, resp.StatusCode, resp.Header, data)
+	if queryErr != nil {
+		return "", queryErr
 	}
-	duration := time.Duration(timeoutSec) * time.Second
-	time.Sleep(duration)
 	return data, nil
 }
+
+// deadLetter keeps the request that used up its retries, so the missing data
+// can be told apart from the data absent in the source
+func deadLetter(storage storage.GenericStorage, queryErr *Error, attempts int) {
+	err := storage.CreateFailedRequest(models.FailedRequest{
+		Request:   queryErr.Request,
+		Kind:      queryErr.Kind,
+		Status:    queryErr.Status,
+		Error:     queryErr.Message,
+		Attempts:  attempts,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+func record(config config.Configuration, recording Recording) {
+	if config.FixturesMode != RecordMode {
+		return
+	}
+	err := SaveRecording(config.FixturesPath, recording)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+// normalizeRequest makes the cache key of the request: the apiKey is dropped
+// and the query parameters are sorted
+func normalizeRequest(requestPath string) string {
+	u, err := url.Parse(requestPath)
+	if err != nil {
+		return requestPath
+	}
+	values := u.Query()
+	values.Del("apiKey")
+	u.RawQuery = values.Encode()
+	return u.String()
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"../config"
+	"../fakeapi"
+	"../keys"
+	"../storage"
+)
+
+// flakyAPI answers the first failures requests with the status in the way
+// of the fake API before passing the requests to it, and counts them
+type flakyAPI struct {
+	api        http.Handler
+	status     int
+	retryAfter string
+	failures   int
+	mutex      sync.Mutex
+	requests   int
+}
+
+func (api *flakyAPI) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	api.mutex.Lock()
+	api.requests++
+	failed := api.requests <= api.failures
+	api.mutex.Unlock()
+	if !failed {
+		api.api.ServeHTTP(writer, request)
+		return
+	}
+	if api.retryAfter != "" {
+		writer.Header().Set("Retry-After", api.retryAfter)
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(api.status)
+	writer.Write([]byte(`{"service-error":{"status":{"statusCode":"GENERAL_SYSTEM_ERROR","statusText":"` +
+		strconv.Itoa(api.status) + `"}}}`))
+}
+
+func TestMakeQueryRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       []string
+		status     int
+		retryAfter string
+		failures   int
+		maxRetries int
+		requests   int
+		kind       string
+		attempts   int
+		minTime    time.Duration
+	}{
+		{"success", []string{"good-key"}, 0, "", 0, 3, 1, "", 0, 0},
+		{"server errors recovered", []string{"good-key"}, http.StatusInternalServerError, "", 2, 3, 3, "", 0, 0},
+		{"server errors", []string{"good-key"}, http.StatusServiceUnavailable, "", 10, 2, 3, ErrorServer, 3, 0},
+		{"no retries", []string{"good-key"}, http.StatusBadGateway, "", 10, 0, 1, ErrorServer, 1, 0},
+		{"throttled", []string{"good-key"}, http.StatusTooManyRequests, "1", 1, 3, 2, "", 0, time.Second},
+		{"throttled out", []string{"good-key"}, http.StatusTooManyRequests, "0", 10, 1, 2, ErrorThrottled, 2, 0},
+		{"throttled without retries", []string{"good-key"}, http.StatusTooManyRequests, "0", 10, 0, 1,
+			ErrorThrottled, 1, 0},
+		{"rejected key replaced", []string{"bad-key", "good-key"}, 0, "", 0, 3, 2, "", 0, 0},
+		{"rejected keys", []string{"bad-key"}, 0, "", 0, 3, 1, ErrorAuth, 0, 0},
+		{"forbidden", []string{"good-key"}, http.StatusForbidden, "", 10, 3, 1, ErrorAuth, 0, 0},
+		{"not found", []string{"good-key"}, http.StatusNotFound, "", 10, 3, 1, ErrorNotFound, 0, 0},
+		{"bad request", []string{"good-key"}, http.StatusBadRequest, "", 10, 3, 1, ErrorBadRequest, 0, 0},
+	}
+	for _, test := range tests {
+		api := &flakyAPI{
+			api:        fakeapi.New("../fakeapi/fixtures", fakeapi.Options{Keys: []string{"good-key"}}),
+			status:     test.status,
+			retryAfter: test.retryAfter,
+			failures:   test.failures,
+		}
+		server := httptest.NewServer(api)
+		Keys = keys.NewPool(test.keys)
+		st := storage.NewMemoryStorage()
+		maxRetries := test.maxRetries
+		conf := config.Configuration{MaxRetries: &maxRetries, RetryBaseDelay: 0.001}
+
+		start := time.Now()
+		data, err := MakeQuery(server.URL+"/content/abstract/scopus_id/{_id_}?httpAccept=application/json&",
+			"85000000001", nil, st, conf, false)
+		elapsed := time.Since(start)
+		server.Close()
+
+		if api.requests != test.requests {
+			t.Errorf("%s: %d requests, want %d", test.name, api.requests, test.requests)
+		}
+		if elapsed < test.minTime {
+			t.Errorf("%s: retried after %v, want at least %v", test.name, elapsed, test.minTime)
+		}
+		if test.kind == "" {
+			if err != nil || !strings.Contains(data, "85000000001") {
+				t.Errorf("%s: %v", test.name, err)
+			}
+		} else if queryErr, ok := err.(*Error); !ok || queryErr.Kind != test.kind {
+			t.Errorf("%s: error %v, want the %s kind", test.name, err, test.kind)
+		}
+
+		failed, err := st.GetFailedRequests()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.attempts == 0 {
+			if len(failed) != 0 {
+				t.Errorf("%s: failed requests %+v", test.name, failed)
+			}
+			continue
+		}
+		if len(failed) != 1 {
+			t.Errorf("%s: failed requests %+v", test.name, failed)
+			continue
+		}
+		request := failed[0]
+		if request.Kind != test.kind || request.Status != test.status || request.Attempts != test.attempts ||
+			request.Error == "" || request.CreatedAt == 0 {
+			t.Errorf("%s: failed request %+v", test.name, request)
+		}
+		if !strings.Contains(request.Request, "/content/abstract/scopus_id/85000000001") ||
+			strings.Contains(request.Request, "apiKey") {
+			t.Errorf("%s: failed request %q", test.name, request.Request)
+		}
+	}
+}
+
+// TestMakeQueryCache checks that a failed request leaves no cached response
+// behind and that a successful retry is served from the storage afterwards
+func TestMakeQueryCache(t *testing.T) {
+	api := &flakyAPI{api: fakeapi.New("../fakeapi/fixtures", fakeapi.Options{}),
+		status: http.StatusInternalServerError, failures: 1}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	Keys = keys.NewPool([]string{"test-key"})
+	st := storage.NewMemoryStorage()
+	noRetries := 0
+	conf := config.Configuration{MaxRetries: &noRetries, RetryBaseDelay: 0.001, CacheTTL: 60}
+	address := server.URL + "/content/affiliation/affiliation_id/{_id_}?httpAccept=application/json&"
+
+	if _, err := MakeQuery(address, "60000001", nil, st, conf, false); err == nil {
+		t.Fatal("server error is not returned")
+	}
+	for i := 0; i < 2; i++ {
+		data, err := MakeQuery(address, "60000001", nil, st, conf, false)
+		if err != nil || !strings.Contains(data, "ITMO University") {
+			t.Fatalf("got %q: %v", data, err)
+		}
+	}
+	if api.requests != 2 {
+		t.Errorf("%d requests, want 2", api.requests)
+	}
+	if _, err := MakeQuery(address, "60000001", nil, st, conf, true); err != nil || api.requests != 3 {
+		t.Errorf("bypassed cache: %d requests: %v", api.requests, err)
+	}
+}
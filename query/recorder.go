@@ -0,0 +1,64 @@
+package query
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Fixtures modes of MakeQuery
+const (
+	RecordMode = "record"
+	ReplayMode = "replay"
+)
+
+// Recording is a response saved in the fixtures directory. The request is
+// normalized, so it never contains the apiKey.
+type Recording struct {
+	Request string `json:"request"`
+	Status  int    `json:"status"`
+	Body    string `json:"body"`
+}
+
+func recordingPath(dir string, request string) string {
+	h := sha1.Sum([]byte(request))
+	return filepath.Join(dir, hex.EncodeToString(h[:])+".json")
+}
+
+func SaveRecording(dir string, recording Recording) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(recordingPath(dir, recording.Request))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(recording)
+}
+
+// LoadRecording finds the response recorded for the request URL
+func LoadRecording(dir string, requestURL string) (Recording, error) {
+	var recording Recording
+	request := normalizeRequest(requestURL)
+	data, err := ioutil.ReadFile(recordingPath(dir, request))
+	if os.IsNotExist(err) {
+		return recording, errors.New("no recorded response for " + request)
+	}
+	if err != nil {
+		return recording, err
+	}
+	err = json.Unmarshal(data, &recording)
+	if err != nil {
+		return recording, err
+	}
+	return recording, nil
+}
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket safe for concurrent use. Tokens are refilled at
+// rate per second up to capacity, every request takes one token. A nil
+// bucket does not limit anything.
+type Bucket struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewBucket returns nil when rate is not positive
+func NewBucket(rate float64, capacity int) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Bucket{
+		interval: time.Duration(float64(time.Second) / rate),
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until a token is available and takes it. Waiting requests are
+// served in the order they came.
+func (bucket *Bucket) Wait() {
+	time.Sleep(bucket.Reserve())
+}
+
+// Reserve takes a token, possibly going into debt, and returns how long the
+// caller has to wait for it
+func (bucket *Bucket) Reserve() time.Duration {
+	if bucket == nil {
+		return 0
+	}
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+	bucket.refill()
+	bucket.tokens--
+	return bucket.debt()
+}
+
+// Delay returns how long a request made now would wait for its token,
+// without taking it
+func (bucket *Bucket) Delay() time.Duration {
+	if bucket == nil {
+		return 0
+	}
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+	bucket.refill()
+	if bucket.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) * float64(bucket.interval))
+}
+
+func (bucket *Bucket) refill() {
+	now := time.Now()
+	bucket.tokens += float64(now.Sub(bucket.last)) / float64(bucket.interval)
+	if bucket.tokens > bucket.capacity {
+		bucket.tokens = bucket.capacity
+	}
+	bucket.last = now
+}
+
+func (bucket *Bucket) debt() time.Duration {
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens * float64(bucket.interval))
+}
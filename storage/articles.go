@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"database/sql"
+	"sort"
+
+	"../models"
+)
+
+// maxQueryArgs keeps multi-row inserts within the SQLite limit of arguments
+const maxQueryArgs = 999
+
+// rowSet collects the rows of a table, a row with the key of one added
+// before replaces it
+type rowSet map[string][]interface{}
+
+func (set rowSet) add(key string, row ...interface{}) {
+	set[key] = row
+}
+
+// sorted returns the rows ordered by key, so concurrent transactions lock
+// them in the same order
+func (set rowSet) sorted() [][]interface{} {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rows := make([][]interface{}, len(keys))
+	for i, key := range keys {
+		rows[i] = set[key]
+	}
+	return rows
+}
+
+// CreateArticles writes the articles with their linked records in a single
+// transaction, nothing is written if any of the inserts fails
+func (storage *MySqlStorage) CreateArticles(articles []models.Article) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = storage.writeArticles(tx, articles)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (storage *MySqlStorage) writeArticles(tx *sql.Tx, articles []models.Article) error {
+	rows, affiliations, areas, authors, keywords := rowSet{}, rowSet{}, rowSet{}, rowSet{}, rowSet{}
+	articleAreas, articleAuthors, articleKeywords, references := rowSet{}, rowSet{}, rowSet{}, rowSet{}
+	articleAffiliations := rowSet{}
+	for _, article := range articles {
+		rows.add(article.ScopusID, article.ScopusID, article.Title, article.Abstracts,
+			storage.dateValue(article.PublicationDate), article.CitationsCount, article.PublicationType,
+			article.PublicationTitle, article.Doi)
+		for _, affiliation := range article.Affiliations {
+			affiliations.add(affiliation.ScopusID, affiliation.ScopusID, affiliation.Title, affiliation.Country,
+				affiliation.City, affiliation.State, affiliation.PostalCode, affiliation.Address)
+			articleAffiliations.add(affiliation.ScopusID+" "+article.ScopusID, affiliation.ScopusID, article.ScopusID)
+		}
+		for _, area := range article.SubjectAreas {
+			areas.add(area.ScopusID, area.ScopusID, area.Title, area.Code, area.Description)
+			articleAreas.add(area.ScopusID+" "+article.ScopusID, area.ScopusID, article.ScopusID)
+		}
+		for position, author := range article.Authors {
+			authors.add(author.ScopusID, author.ScopusID, author.Initials, author.IndexedName, author.Surname,
+				author.Name, storage.affiliationsValue(author.AffiliationID))
+			articleAuthors.add(author.ScopusID+" "+article.ScopusID, author.ScopusID, article.ScopusID,
+				storage.affiliationsValue(author.AffiliationID), position)
+		}
+		for _, keyword := range article.Keywords {
+			keywords.add(keyword.ID, keyword.ID, keyword.Value)
+			articleKeywords.add(keyword.ID+" "+article.ScopusID, keyword.ID, article.ScopusID)
+		}
+		for _, reference := range article.References {
+			references.add(article.ScopusID+" "+reference.ScopusID, article.ScopusID, reference.ScopusID)
+		}
+	}
+	// the complete affiliations from the Affiliation Retrieval API are not overwritten
+	err := execRows(tx, affiliations.sorted(), func(n int) string {
+		return storage.insertIgnoreRowsQuery("affiliations", n, "scopus_id", "title", "country", "city", "state",
+			"postal_code", "address")
+	})
+	if err != nil {
+		return err
+	}
+	err = execRows(tx, areas.sorted(), func(n int) string {
+		return storage.upsertRowsQuery("subject_areas", n, []string{"scopus_id"}, "title", "code", "description")
+	})
+	if err != nil {
+		return err
+	}
+	err = execRows(tx, authors.sorted(), func(n int) string {
+		return storage.upsertRowsQuery("authors", n, []string{"scopus_id"}, "initials", "indexed_name", "surname",
+			"name", "affiliation_id")
+	})
+	if err != nil {
+		return err
+	}
+	err = execRows(tx, keywords.sorted(), func(n int) string {
+		return storage.upsertRowsQuery("keywords", n, []string{"id"}, "keyword")
+	})
+	if err != nil {
+		return err
+	}
+	err = execRows(tx, rows.sorted(), func(n int) string {
+		return storage.upsertRowsQuery("articles", n, []string{"scopus_id"}, "title", "abstracts",
+			"publication_date", "citations_count", "publication_type", "publication_title", "doi")
+	})
+	if err != nil {
+		return err
+	}
+	err = execRows(tx, articleAreas.sorted(), func(n int) string {
+		return storage.insertIgnoreRowsQuery("article_area", n, "area_id", "article_id")
+	})
+	if err != nil {
+		return err
+	}
+	err = execRows(tx, articleAuthors.sorted(), func(n int) string {
+		return storage.upsertRowsQuery("article_author", n, []string{"author_id", "article_id"}, "author_affiliations",
+			"author_position")
+	})
+	if err != nil {
+		return err
+	}
+	err = execRows(tx, articleAffiliations.sorted(), func(n int) string {
+		return storage.insertIgnoreRowsQuery("article_affiliation", n, "affiliation_id", "article_id")
+	})
+	if err != nil {
+		return err
+	}
+	err = execRows(tx, articleKeywords.sorted(), func(n int) string {
+		return storage.insertIgnoreRowsQuery("article_keyword", n, "keyword_id", "article_id")
+	})
+	if err != nil {
+		return err
+	}
+	return execRows(tx, references.sorted(), func(n int) string {
+		return storage.insertIgnoreRowsQuery("article_article", n, "from_id", "to_id")
+	})
+}
+
+// execRows inserts the rows with the statements built by query for the
+// given number of rows, as many rows per statement as maxQueryArgs allows
+func execRows(tx *sql.Tx, rows [][]interface{}, query func(n int) string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	perStatement := maxQueryArgs / len(rows[0])
+	for start := 0; start < len(rows); start += perStatement {
+		end := start + perStatement
+		if end > len(rows) {
+			end = len(rows)
+		}
+		args := make([]interface{}, 0, (end-start)*len(rows[0]))
+		for _, row := range rows[start:end] {
+			args = append(args, row...)
+		}
+		_, err := tx.Exec(query(end-start), args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
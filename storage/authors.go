@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"../models"
+)
+
+const createAuthorProfilesTable = `CREATE TABLE IF NOT EXISTS author_profiles (
+	scopus_id VARCHAR(20),
+	h_index INTEGER,
+	document_count INTEGER,
+	cited_by_count INTEGER,
+	citation_count INTEGER,
+	orcid VARCHAR(32),
+	updated_at BIGINT,
+	PRIMARY KEY (scopus_id)
+)`
+
+const createAuthorNameVariantsTable = `CREATE TABLE IF NOT EXISTS author_name_variant(
+	author_id VARCHAR(20) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	PRIMARY KEY (author_id, name)
+)`
+
+const createAuthorAreasTable = `CREATE TABLE IF NOT EXISTS author_area(
+	author_id VARCHAR(20) NOT NULL,
+	area_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (author_id, area_id)
+)`
+
+const createAuthorAffiliationsTable = `CREATE TABLE IF NOT EXISTS author_affiliation(
+	author_id VARCHAR(20) NOT NULL,
+	affiliation_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (author_id, affiliation_id)
+)`
+
+var authorLinkSchema = []string{createAuthorNameVariantsTable, createAuthorAreasTable, createAuthorAffiliationsTable}
+
+var authorLinkTables = []linkTable{
+	{"author_name_variant", []string{"author_id", "name"}, nil},
+	{"author_area", []string{"author_id", "area_id"}, nil},
+	{"author_affiliation", []string{"author_id", "affiliation_id"}, nil},
+}
+
+// CreateAuthorProfile stores the author with the profile in a single
+// transaction, the name variants, subject areas and affiliation history of
+// a previous profile are replaced
+func (storage *MySqlStorage) CreateAuthorProfile(author models.Author) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = storage.writeAuthorProfile(tx, author)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (storage *MySqlStorage) writeAuthorProfile(tx *sql.Tx, author models.Author) error {
+	_, err := tx.Exec(storage.upsertQuery("authors", []string{"scopus_id"}, "initials", "indexed_name", "surname",
+		"name", "affiliation_id"), author.ScopusID, author.Initials, author.IndexedName, author.Surname, author.Name,
+		storage.affiliationsValue(author.AffiliationID))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(storage.upsertQuery("author_profiles", []string{"scopus_id"}, "h_index", "document_count",
+		"cited_by_count", "citation_count", "orcid", "updated_at"), author.ScopusID, author.HIndex,
+		author.DocumentCount, author.CitedByCount, author.CitationCount, author.Orcid, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	names, areas, authorAreas, affiliations := rowSet{}, rowSet{}, rowSet{}, rowSet{}
+	for _, name := range author.NameVariants {
+		names.add(name, author.ScopusID, name)
+	}
+	for _, area := range author.SubjectAreas {
+		areas.add(area.ScopusID, area.ScopusID, area.Title, area.Code, area.Description)
+		authorAreas.add(area.ScopusID, author.ScopusID, area.ScopusID)
+	}
+	for _, affiliationID := range author.AffiliationHistory {
+		affiliations.add(affiliationID, author.ScopusID, affiliationID)
+	}
+	err = execRows(tx, areas.sorted(), func(n int) string {
+		return storage.upsertRowsQuery("subject_areas", n, []string{"scopus_id"}, "title", "code", "description")
+	})
+	if err != nil {
+		return err
+	}
+	for _, table := range authorLinkTables {
+		_, err = tx.Exec(storage.rebind("DELETE FROM "+table.name+" WHERE author_id = ?"), author.ScopusID)
+		if err != nil {
+			return err
+		}
+	}
+	for i, rows := range []rowSet{names, authorAreas, affiliations} {
+		table := authorLinkTables[i]
+		err = execRows(tx, rows.sorted(), func(n int) string {
+			return storage.insertIgnoreRowsQuery(table.name, n, table.columns...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAuthorProfile adds the profile to the author, authors without a profile
+// are left as they are
+func (storage *MySqlStorage) loadAuthorProfile(db *sql.DB, author *models.Author) error {
+	err := db.QueryRow(storage.rebind(`SELECT h_index, document_count, cited_by_count, citation_count, orcid
+		FROM author_profiles WHERE scopus_id = ?`), author.ScopusID).Scan(&author.HIndex, &author.DocumentCount,
+		&author.CitedByCount, &author.CitationCount, &author.Orcid)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ids := []string{author.ScopusID}
+	err = storage.queryByArticles(db, `SELECT name FROM author_name_variant
+		WHERE author_id IN (%s) ORDER BY name`,
+		ids, func(res *sql.Rows) error {
+			var name string
+			err := res.Scan(&name)
+			author.NameVariants = append(author.NameVariants, name)
+			return err
+		})
+	if err != nil {
+		return err
+	}
+	err = storage.queryByArticles(db, `SELECT s.scopus_id, s.title, s.code, s.description
+		FROM author_area l JOIN subject_areas s ON s.scopus_id = l.area_id
+		WHERE l.author_id IN (%s) ORDER BY s.scopus_id`,
+		ids, func(res *sql.Rows) error {
+			var area models.SubjectArea
+			err := res.Scan(&area.ScopusID, &area.Title, &area.Code, &area.Description)
+			author.SubjectAreas = append(author.SubjectAreas, area)
+			return err
+		})
+	if err != nil {
+		return err
+	}
+	return storage.queryByArticles(db, `SELECT affiliation_id FROM author_affiliation
+		WHERE author_id IN (%s) ORDER BY affiliation_id`,
+		ids, func(res *sql.Rows) error {
+			var affiliationID string
+			err := res.Scan(&affiliationID)
+			author.AffiliationHistory = append(author.AffiliationHistory, affiliationID)
+			return err
+		})
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"../models"
+)
+
+const defaultBatchInterval = 500 * time.Millisecond
+
+// ArticleBatcher groups the articles stored by many workers into a single
+// transaction. A batch is written when it has Size articles or Interval
+// after its first article was added. Store returns once the article is
+// committed, so the task of a worker is never done before its article is
+// written.
+type ArticleBatcher struct {
+	Storage  GenericStorage
+	Size     int
+	Interval time.Duration
+	mutex    sync.Mutex
+	articles []models.Article
+	waiters  []chan error
+	timer    *time.Timer
+}
+
+func NewArticleBatcher(storage GenericStorage, size int, interval time.Duration) *ArticleBatcher {
+	if interval <= 0 {
+		interval = defaultBatchInterval
+	}
+	return &ArticleBatcher{Storage: storage, Size: size, Interval: interval}
+}
+
+// Store adds the article to the current batch and waits until it is written
+func (batcher *ArticleBatcher) Store(article models.Article) error {
+	done := make(chan error, 1)
+	batcher.mutex.Lock()
+	batcher.articles = append(batcher.articles, article)
+	batcher.waiters = append(batcher.waiters, done)
+	if len(batcher.articles) >= batcher.Size {
+		articles, waiters := batcher.take()
+		batcher.mutex.Unlock()
+		batcher.write(articles, waiters)
+	} else {
+		if batcher.timer == nil {
+			batcher.timer = time.AfterFunc(batcher.Interval, batcher.Flush)
+		}
+		batcher.mutex.Unlock()
+	}
+	return <-done
+}
+
+// Flush writes the current batch
+func (batcher *ArticleBatcher) Flush() {
+	batcher.mutex.Lock()
+	articles, waiters := batcher.take()
+	batcher.mutex.Unlock()
+	batcher.write(articles, waiters)
+}
+
+func (batcher *ArticleBatcher) take() ([]models.Article, []chan error) {
+	articles, waiters := batcher.articles, batcher.waiters
+	batcher.articles, batcher.waiters = nil, nil
+	if batcher.timer != nil {
+		batcher.timer.Stop()
+		batcher.timer = nil
+	}
+	return articles, waiters
+}
+
+// write commits the batch. If it fails the articles are written one by one,
+// so a bad article fails only its own worker.
+func (batcher *ArticleBatcher) write(articles []models.Article, waiters []chan error) {
+	if len(articles) == 0 {
+		return
+	}
+	err := batcher.Storage.CreateArticles(articles)
+	if err == nil || len(articles) == 1 {
+		for _, waiter := range waiters {
+			waiter <- err
+		}
+		return
+	}
+	for i, article := range articles {
+		waiters[i] <- batcher.Storage.CreateArticle(article)
+	}
+}
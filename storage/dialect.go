@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// rebind converts ? placeholders into the numbered ones used by Postgres
+func (storage *MySqlStorage) rebind(query string) string {
+	if storage.DBType != POSTGRES {
+		return query
+	}
+	var result strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			result.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		result.WriteRune(r)
+	}
+	return result.String()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// upsertQuery builds an insert of the key and value columns which updates the
+// value columns when a row with the same key already exists
+func (storage *MySqlStorage) upsertQuery(table string, keys []string, columns ...string) string {
+	return storage.upsertRowsQuery(table, 1, keys, columns...)
+}
+
+// upsertRowsQuery is upsertQuery inserting several rows at once. The rows
+// must have distinct keys, Postgres refuses to update a row twice.
+func (storage *MySqlStorage) upsertRowsQuery(table string, rows int, keys []string, columns ...string) string {
+	all := append(append([]string{}, keys...), columns...)
+	query := "INSERT INTO " + table + " (" + strings.Join(all, ", ") + ") VALUES " + rowsValues(len(all), rows)
+	updates := make([]string, len(columns))
+	if storage.DBType == MYSQL {
+		for i, column := range columns {
+			updates[i] = column + " = VALUES(" + column + ")"
+		}
+		return query + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+	for i, column := range columns {
+		updates[i] = column + " = excluded." + column
+	}
+	return storage.rebind(query + " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " +
+		strings.Join(updates, ", "))
+}
+
+// insertIgnoreQuery builds an insert which skips rows violating unique keys
+func (storage *MySqlStorage) insertIgnoreQuery(table string, columns ...string) string {
+	return storage.insertIgnoreRowsQuery(table, 1, columns...)
+}
+
+func (storage *MySqlStorage) insertIgnoreRowsQuery(table string, rows int, columns ...string) string {
+	return storage.insertIgnoreSelectQuery(table, columns, "VALUES "+rowsValues(len(columns), rows))
+}
+
+// insertIgnoreSelectQuery inserts the rows given by the VALUES or SELECT
+// clause, skipping the ones which violate unique keys
+func (storage *MySqlStorage) insertIgnoreSelectQuery(table string, columns []string, rows string) string {
+	values := " (" + strings.Join(columns, ", ") + ") " + rows
+	switch storage.DBType {
+	case SQLITE:
+		return "INSERT OR IGNORE INTO " + table + values
+	case POSTGRES:
+		return storage.rebind("INSERT INTO " + table + values + " ON CONFLICT DO NOTHING")
+	default:
+		return "INSERT IGNORE INTO " + table + values
+	}
+}
+
+func rowsValues(columns int, rows int) string {
+	row := "(" + placeholders(columns) + ")"
+	return strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+}
+
+// dateValue converts Scopus dates for the DATE column of Postgres. Incomplete
+// dates like the publication year of references are moved to the first day.
+func (storage *MySqlStorage) dateValue(date string) interface{} {
+	if storage.DBType != POSTGRES {
+		return date
+	}
+	switch len(date) {
+	case 0:
+		return nil
+	case 4:
+		return date + "-01-01"
+	case 7:
+		return date + "-01"
+	default:
+		return date
+	}
+}
+
+// affiliationsValue stores the author affiliations as an array in Postgres
+// and as a comma separated list elsewhere
+func (storage *MySqlStorage) affiliationsValue(ids []string) interface{} {
+	if storage.DBType == POSTGRES {
+		return pq.Array(ids)
+	}
+	return strings.Join(ids, ",")
+}
+
+// affiliationsDest reads the affiliations written with affiliationsValue
+func (storage *MySqlStorage) affiliationsDest(ids *[]string) interface{} {
+	if storage.DBType == POSTGRES {
+		return pq.Array(ids)
+	}
+	return commaList{ids}
+}
+
+// commaList scans a comma separated list, NULL is read as an empty one
+type commaList struct {
+	values *[]string
+}
+
+func (list commaList) Scan(src interface{}) error {
+	var value string
+	switch src := src.(type) {
+	case nil:
+	case []byte:
+		value = string(src)
+	case string:
+		value = src
+	default:
+		return fmt.Errorf("unable to read %T as a list", src)
+	}
+	*list.values = nil
+	if value != "" {
+		*list.values = strings.Split(value, ",")
+	}
+	return nil
+}
+
+const authorColumns = "scopus_id, affiliation_id, initials, indexed_name, surname, name"
+
+func (storage *MySqlStorage) articleColumns() string {
+	date := "publication_date"
+	if storage.DBType == POSTGRES {
+		date = "COALESCE(TO_CHAR(publication_date, 'YYYY-MM-DD'), '')"
+	}
+	return "scopus_id, title, abstracts, " + date + ", citations_count, publication_type, publication_title, doi"
+}
@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operators of the filter conditions
+const (
+	Equal          = "="
+	NotEqual       = "<>"
+	Less           = "<"
+	LessOrEqual    = "<="
+	Greater        = ">"
+	GreaterOrEqual = ">="
+	// Like matches the SQL pattern with % and _ ignoring the case
+	Like = "like"
+	// In takes a list of values
+	In = "in"
+)
+
+// maxSearchLimit stands for no limit when only the offset is given
+const maxSearchLimit = 1 << 62
+
+// Condition compares a column of the searched table with the value
+type Condition struct {
+	Column string      `json:"column"`
+	Op     string      `json:"op"`
+	Value  interface{} `json:"value"`
+}
+
+// Filter selects the records of the Search methods of the storage, the
+// records have to match all the conditions. Records are ordered by the key
+// of the table unless OrderBy is given.
+type Filter struct {
+	Conditions []Condition `json:"conditions"`
+	OrderBy    string      `json:"orderBy"`
+	Descending bool        `json:"descending"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+}
+
+// Where adds a condition to the filter
+func (filter Filter) Where(column string, op string, value interface{}) Filter {
+	filter.Conditions = append(append([]Condition{}, filter.Conditions...), Condition{column, op, value})
+	return filter
+}
+
+// Range adds the conditions of the column being within from and to, both included
+func (filter Filter) Range(column string, from interface{}, to interface{}) Filter {
+	return filter.Where(column, GreaterOrEqual, from).Where(column, LessOrEqual, to)
+}
+
+type columnKind int
+
+const (
+	textColumn columnKind = iota
+	intColumn
+	dateColumn
+)
+
+type searchTable struct {
+	key     string
+	columns map[string]columnKind
+}
+
+// searchTables are the tables and the columns the filters may use
+var searchTables = map[string]searchTable{
+	"articles": {"scopus_id", map[string]columnKind{
+		"scopus_id":         textColumn,
+		"title":             textColumn,
+		"abstracts":         textColumn,
+		"publication_date":  dateColumn,
+		"citations_count":   intColumn,
+		"publication_type":  textColumn,
+		"publication_title": textColumn,
+		"doi":               textColumn,
+	}},
+	"authors": {"scopus_id", map[string]columnKind{
+		"scopus_id":    textColumn,
+		"initials":     textColumn,
+		"indexed_name": textColumn,
+		"surname":      textColumn,
+		"name":         textColumn,
+	}},
+	"affiliations": {"scopus_id", map[string]columnKind{
+		"scopus_id":   textColumn,
+		"title":       textColumn,
+		"country":     textColumn,
+		"city":        textColumn,
+		"state":       textColumn,
+		"postal_code": textColumn,
+		"address":     textColumn,
+	}},
+	"keywords": {"id", map[string]columnKind{
+		"id":      textColumn,
+		"keyword": textColumn,
+	}},
+	"subject_areas": {"scopus_id", map[string]columnKind{
+		"scopus_id":   textColumn,
+		"title":       textColumn,
+		"code":        textColumn,
+		"description": textColumn,
+	}},
+}
+
+// Validate checks the filter can be used to search the table
+func (filter Filter) Validate(table string) error {
+	_, err := filter.normalize(table)
+	return err
+}
+
+// normalize checks the filter and converts the values to the types of the
+// columns
+func (filter Filter) normalize(table string) (Filter, error) {
+	columns, ok := searchTables[table]
+	if !ok {
+		return filter, errors.New("unable to search table " + table)
+	}
+	if filter.Limit < 0 || filter.Offset < 0 {
+		return filter, errors.New("limit and offset must not be negative")
+	}
+	if filter.OrderBy != "" {
+		if _, ok := columns.columns[filter.OrderBy]; !ok {
+			return filter, errors.New("unable to order " + table + " by " + filter.OrderBy)
+		}
+	}
+	conditions := make([]Condition, len(filter.Conditions))
+	for i, condition := range filter.Conditions {
+		kind, ok := columns.columns[condition.Column]
+		if !ok {
+			return filter, errors.New("unable to search " + table + " by " + condition.Column)
+		}
+		switch condition.Op {
+		case Equal, NotEqual, Less, LessOrEqual, Greater, GreaterOrEqual:
+			value, err := columnValue(kind, condition.Value)
+			if err != nil {
+				return filter, errors.New(condition.Column + ": " + err.Error())
+			}
+			condition.Value = value
+		case Like:
+			if kind != textColumn {
+				return filter, errors.New(condition.Column + " can not be matched with like")
+			}
+			value, err := columnValue(kind, condition.Value)
+			if err != nil {
+				return filter, errors.New(condition.Column + ": " + err.Error())
+			}
+			condition.Value = value
+		case In:
+			list, ok := condition.Value.([]interface{})
+			if texts, isTexts := condition.Value.([]string); isTexts {
+				list, ok = make([]interface{}, len(texts)), true
+				for j, item := range texts {
+					list[j] = item
+				}
+			}
+			if !ok {
+				return filter, errors.New(condition.Column + ": in takes a list of values")
+			}
+			values := make([]interface{}, len(list))
+			for j, item := range list {
+				value, err := columnValue(kind, item)
+				if err != nil {
+					return filter, errors.New(condition.Column + ": " + err.Error())
+				}
+				values[j] = value
+			}
+			condition.Value = values
+		default:
+			return filter, errors.New("unknown operator " + condition.Op)
+		}
+		conditions[i] = condition
+	}
+	filter.Conditions = conditions
+	return filter, nil
+}
+
+// columnValue converts the value to int64 for the integer columns and to
+// string for the others
+func columnValue(kind columnKind, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		if kind != intColumn {
+			return value, nil
+		}
+		return strconv.ParseInt(value, 10, 64)
+	case json.Number:
+		if kind != intColumn {
+			return value.String(), nil
+		}
+		return value.Int64()
+	case float64:
+		if kind != intColumn {
+			return strconv.FormatFloat(value, 'f', -1, 64), nil
+		}
+		if value != float64(int64(value)) {
+			return nil, fmt.Errorf("%v is not an integer", value)
+		}
+		return int64(value), nil
+	case int:
+		if kind != intColumn {
+			return strconv.Itoa(value), nil
+		}
+		return int64(value), nil
+	case int64:
+		if kind != intColumn {
+			return strconv.FormatInt(value, 10), nil
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// searchQuery builds the parameterized query of the columns of the records
+// of the table selected by the filter
+func (storage *MySqlStorage) searchQuery(table string, columns string, filter Filter) (string, []interface{},
+	error) {
+	filter, err := filter.normalize(table)
+	if err != nil {
+		return "", nil, err
+	}
+	conditions := []string{}
+	args := []interface{}{}
+	for _, condition := range filter.Conditions {
+		kind := searchTables[table].columns[condition.Column]
+		switch condition.Op {
+		case In:
+			values := condition.Value.([]interface{})
+			if len(values) == 0 {
+				conditions = append(conditions, "1 = 0")
+				continue
+			}
+			conditions = append(conditions, condition.Column+" IN ("+placeholders(len(values))+")")
+			for _, value := range values {
+				args = append(args, storage.filterValue(kind, value))
+			}
+		case Like:
+			op := "LIKE"
+			if storage.DBType == POSTGRES {
+				op = "ILIKE"
+			}
+			conditions = append(conditions, condition.Column+" "+op+" ?")
+			args = append(args, condition.Value)
+		default:
+			conditions = append(conditions, condition.Column+" "+condition.Op+" ?")
+			args = append(args, storage.filterValue(kind, condition.Value))
+		}
+	}
+	query := "SELECT " + columns + " FROM " + table
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	orderBy := filter.OrderBy
+	if orderBy == "" {
+		orderBy = searchTables[table].key
+	}
+	query += " ORDER BY " + orderBy
+	if filter.Descending {
+		query += " DESC"
+	}
+	if filter.Limit > 0 || filter.Offset > 0 {
+		limit := filter.Limit
+		if limit == 0 {
+			limit = maxSearchLimit
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, filter.Offset)
+	}
+	return storage.rebind(query), args, nil
+}
+
+func (storage *MySqlStorage) filterValue(kind columnKind, value interface{}) interface{} {
+	if kind == dateColumn {
+		return storage.dateValue(value.(string))
+	}
+	return value
+}
+
+// apply selects the records of the memory storage matching the filter. It
+// returns the indexes of the records in the order of the filter.
+func (filter Filter) apply(table string, records []map[string]string) ([]int, error) {
+	filter, err := filter.normalize(table)
+	if err != nil {
+		return nil, err
+	}
+	columns := searchTables[table]
+	selected := []int{}
+	for i, record := range records {
+		if filter.match(columns, record) {
+			selected = append(selected, i)
+		}
+	}
+	orderBy := filter.OrderBy
+	if orderBy == "" {
+		orderBy = columns.key
+	}
+	kind := columns.columns[orderBy]
+	sort.SliceStable(selected, func(i, j int) bool {
+		a := recordValue(kind, records[selected[i]][orderBy])
+		b := recordValue(kind, records[selected[j]][orderBy])
+		if filter.Descending {
+			return compareValues(b, a) < 0
+		}
+		return compareValues(a, b) < 0
+	})
+	if filter.Offset >= len(selected) {
+		return []int{}, nil
+	}
+	selected = selected[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(selected) {
+		selected = selected[:filter.Limit]
+	}
+	return selected, nil
+}
+
+func (filter Filter) match(columns searchTable, record map[string]string) bool {
+	for _, condition := range filter.Conditions {
+		value := recordValue(columns.columns[condition.Column], record[condition.Column])
+		var ok bool
+		switch condition.Op {
+		case Equal:
+			ok = compareValues(value, condition.Value) == 0
+		case NotEqual:
+			ok = compareValues(value, condition.Value) != 0
+		case Less:
+			ok = compareValues(value, condition.Value) < 0
+		case LessOrEqual:
+			ok = compareValues(value, condition.Value) <= 0
+		case Greater:
+			ok = compareValues(value, condition.Value) > 0
+		case GreaterOrEqual:
+			ok = compareValues(value, condition.Value) >= 0
+		case Like:
+			ok = likePattern(condition.Value.(string)).MatchString(value.(string))
+		case In:
+			for _, item := range condition.Value.([]interface{}) {
+				if compareValues(value, item) == 0 {
+					ok = true
+					break
+				}
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// recordValue converts the column of a memory record, empty numbers are 0
+func recordValue(kind columnKind, value string) interface{} {
+	converted, err := columnValue(kind, value)
+	if err != nil {
+		return int64(0)
+	}
+	return converted
+}
+
+// compareValues compares two values converted by columnValue for the same column
+func compareValues(a interface{}, b interface{}) int {
+	if a, ok := a.(int64); ok {
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+// likePattern converts the SQL pattern into a regular expression
+func likePattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
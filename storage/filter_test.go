@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"../models"
+)
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		dbType DatabaseType
+		table  string
+		filter Filter
+		query  string
+		args   []interface{}
+	}{
+		{"no conditions", MYSQL, "articles", Filter{},
+			"SELECT c FROM articles ORDER BY scopus_id", []interface{}{}},
+		{"table key", SQLITE, "keywords", Filter{},
+			"SELECT c FROM keywords ORDER BY id", []interface{}{}},
+		{"integer from a string", SQLITE, "articles", Filter{}.Where("citations_count", GreaterOrEqual, "5"),
+			"SELECT c FROM articles WHERE citations_count >= ? ORDER BY scopus_id", []interface{}{int64(5)}},
+		{"integer from JSON", MYSQL, "articles", Filter{}.Where("citations_count", Less, float64(7)),
+			"SELECT c FROM articles WHERE citations_count < ? ORDER BY scopus_id", []interface{}{int64(7)}},
+		{"text from a number", MYSQL, "articles", Filter{}.Where("scopus_id", Equal, 85),
+			"SELECT c FROM articles WHERE scopus_id = ? ORDER BY scopus_id", []interface{}{"85"}},
+		{"like", SQLITE, "authors", Filter{}.Where("surname", Like, "iv%"),
+			"SELECT c FROM authors WHERE surname LIKE ? ORDER BY scopus_id", []interface{}{"iv%"}},
+		{"like on postgres", POSTGRES, "authors", Filter{}.Where("surname", Like, "iv%").Where("name", NotEqual, "x"),
+			"SELECT c FROM authors WHERE surname ILIKE $1 AND name <> $2 ORDER BY scopus_id",
+			[]interface{}{"iv%", "x"}},
+		{"in", MYSQL, "affiliations", Filter{}.Where("country", In, []string{"Russia", "Netherlands"}),
+			"SELECT c FROM affiliations WHERE country IN (?, ?) ORDER BY scopus_id",
+			[]interface{}{"Russia", "Netherlands"}},
+		{"empty in", MYSQL, "affiliations", Filter{}.Where("country", In, []interface{}{}),
+			"SELECT c FROM affiliations WHERE 1 = 0 ORDER BY scopus_id", []interface{}{}},
+		{"postgres year", POSTGRES, "articles", Filter{}.Range("publication_date", "2014", "2016-05"),
+			"SELECT c FROM articles WHERE publication_date >= $1 AND publication_date <= $2 ORDER BY scopus_id",
+			[]interface{}{"2014-01-01", "2016-05-01"}},
+		{"order and page", SQLITE, "articles",
+			Filter{OrderBy: "citations_count", Descending: true, Limit: 10, Offset: 20},
+			"SELECT c FROM articles ORDER BY citations_count DESC LIMIT ? OFFSET ?", []interface{}{10, 20}},
+		{"offset only", POSTGRES, "subject_areas", Filter{Offset: 5},
+			"SELECT c FROM subject_areas ORDER BY scopus_id LIMIT $1 OFFSET $2",
+			[]interface{}{maxSearchLimit, 5}},
+	}
+	for _, test := range tests {
+		storage := &MySqlStorage{DBType: test.dbType}
+		query, args, err := storage.searchQuery(test.table, "c", test.filter)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if query != test.query {
+			t.Errorf("%s: query %q, want %q", test.name, query, test.query)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: args %#v, want %#v", test.name, args, test.args)
+		}
+	}
+}
+
+func TestSearchQueryRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		table  string
+		filter Filter
+	}{
+		{"unknown table", "users", Filter{}},
+		{"link table", "article_author", Filter{}},
+		{"unknown column", "articles", Filter{}.Where("password", Equal, "x")},
+		{"column of another table", "articles", Filter{}.Where("surname", Equal, "x")},
+		{"injected column", "articles", Filter{}.Where("title = title OR 1", Equal, "x")},
+		{"unknown order column", "articles", Filter{OrderBy: "rand()"}},
+		{"injected order", "articles", Filter{OrderBy: "title; DROP TABLE articles"}},
+		{"order with a direction", "articles", Filter{OrderBy: "title DESC"}},
+		{"unknown operator", "articles", Filter{}.Where("title", "regexp", "x")},
+		{"raw operator", "articles", Filter{}.Where("title", "= 1 OR title =", "x")},
+		{"like on a number", "articles", Filter{}.Where("citations_count", Like, "1%")},
+		{"text for a number", "articles", Filter{}.Where("citations_count", Equal, "many")},
+		{"fraction for a number", "articles", Filter{}.Where("citations_count", Equal, 1.5)},
+		{"in without a list", "articles", Filter{}.Where("scopus_id", In, "1,2")},
+		{"unsupported value", "articles", Filter{}.Where("title", Equal, true)},
+		{"negative limit", "articles", Filter{Limit: -1}},
+		{"negative offset", "articles", Filter{Offset: -1}},
+	}
+	for _, test := range tests {
+		for _, dbType := range []DatabaseType{MYSQL, SQLITE, POSTGRES} {
+			storage := &MySqlStorage{DBType: dbType}
+			query, _, err := storage.searchQuery(test.table, "c", test.filter)
+			if err == nil {
+				t.Errorf("%s: %q is built", test.name, query)
+			}
+		}
+		if _, err := test.filter.apply(test.table, nil); err == nil {
+			t.Errorf("%s: the memory filter is applied", test.name)
+		}
+	}
+}
+
+// TestSearchParity runs the same filters on the memory and the SQLite
+// storages, which have to find the same records in the same order
+func TestSearchParity(t *testing.T) {
+	memory := NewMemoryStorage()
+	sqlite := openSQL(t, sqliteStorage(t))
+	articles := []models.Article{
+		testArticle("10", "Graph Theory", 3),
+		testArticle("2", "Random graphs", 10),
+		testArticle("3", "Trees", 7),
+		testArticle("4", "graph_theory notes", 0),
+		testArticle("5", "Planar Graphs", 25),
+	}
+	articles[2].PublicationDate = "2015-03-01"
+	articles[3].PublicationDate = "2020-12-31"
+	articles[4].Doi = ""
+	authors := []models.Author{
+		{ScopusID: "71", Surname: "Ivanov", IndexedName: "Ivanov A.", Name: "Alexey"},
+		{ScopusID: "72", Surname: "Petrova", IndexedName: "Petrova M.", Name: "Maria"},
+		{ScopusID: "73", Surname: "ivanova", IndexedName: "Ivanova E."},
+	}
+	articles[0].Authors = authors
+	for _, storage := range []GenericStorage{memory, sqlite} {
+		if err := storage.CreateArticles(articles); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	articleFilters := []Filter{
+		{},
+		{Descending: true},
+		Filter{}.Where("title", Like, "%graph%"),
+		Filter{}.Where("title", Like, "graph_theory%"),
+		Filter{}.Where("title", Like, "_rees"),
+		Filter{}.Where("citations_count", Greater, 5),
+		Filter{}.Where("citations_count", LessOrEqual, "3"),
+		Filter{}.Where("citations_count", NotEqual, 7).Where("title", Like, "%s"),
+		Filter{}.Where("scopus_id", Greater, "2"),
+		Filter{}.Where("scopus_id", In, []string{"2", "5", "missing"}),
+		Filter{}.Where("citations_count", In, []interface{}{float64(3), "25"}),
+		Filter{}.Where("scopus_id", In, []interface{}{}),
+		Filter{}.Where("doi", Equal, ""),
+		Filter{}.Range("publication_date", "2016-01-01", "2020-12-31"),
+		Filter{}.Where("publication_date", Less, "2019"),
+		{OrderBy: "citations_count"},
+		{OrderBy: "citations_count", Descending: true, Limit: 2},
+		{OrderBy: "title", Offset: 1, Limit: 3},
+		{OrderBy: "publication_date", Descending: true, Offset: 4},
+		{Offset: 10},
+	}
+	for _, filter := range articleFilters {
+		fromMemory, err := memory.SearchArticles(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromSQLite, err := sqlite.SearchArticles(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(articleIDs(fromMemory), articleIDs(fromSQLite)) {
+			t.Errorf("%+v: memory %v, sqlite %v", filter, articleIDs(fromMemory), articleIDs(fromSQLite))
+		}
+	}
+
+	authorFilters := []Filter{
+		Filter{}.Where("surname", Like, "ivanov%"),
+		Filter{}.Where("surname", Equal, "Ivanov"),
+		Filter{}.Where("name", Equal, ""),
+		{OrderBy: "surname"},
+		{OrderBy: "indexed_name", Descending: true},
+	}
+	for _, filter := range authorFilters {
+		fromMemory, err := memory.SearchAuthors(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromSQLite, err := sqlite.SearchAuthors(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var memoryIDs, sqliteIDs []string
+		for _, author := range fromMemory {
+			memoryIDs = append(memoryIDs, author.ScopusID)
+		}
+		for _, author := range fromSQLite {
+			sqliteIDs = append(sqliteIDs, author.ScopusID)
+		}
+		if strings.Join(memoryIDs, ",") != strings.Join(sqliteIDs, ",") {
+			t.Errorf("%+v: memory %v, sqlite %v", filter, memoryIDs, sqliteIDs)
+		}
+	}
+}
+
+func articleIDs(articles []models.Article) []string {
+	ids := []string{}
+	for _, article := range articles {
+		ids = append(ids, article.ScopusID)
+	}
+	return ids
+}
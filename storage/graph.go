@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"../models"
+)
+
+// LoadOptions choose the relations GetArticle and GetArticles load with the
+// articles. The references have the columns of the referenced articles which
+// are in the storage and only the ScopusID otherwise.
+type LoadOptions struct {
+	Authors      bool
+	Affiliations bool
+	Keywords     bool
+	SubjectAreas bool
+	References   bool
+}
+
+// LoadAll loads every relation of the articles
+var LoadAll = LoadOptions{Authors: true, Affiliations: true, Keywords: true, SubjectAreas: true, References: true}
+
+// GetArticle returns the article with the relations chosen by load
+func (storage *MySqlStorage) GetArticle(scopusID string, load LoadOptions) (models.Article, error) {
+	articles, err := storage.GetArticles([]string{scopusID}, load)
+	if err != nil {
+		return models.Article{}, err
+	}
+	if len(articles) == 0 {
+		return models.Article{}, ErrNotFound
+	}
+	return articles[0], nil
+}
+
+// GetArticles returns the articles which are in the storage in the order of
+// scopusIDs, with the relations chosen by load. Every relation takes a single
+// query for all the articles.
+func (storage *MySqlStorage) GetArticles(scopusIDs []string, load LoadOptions) ([]models.Article, error) {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]*models.Article{}
+	err = storage.queryByArticles(db, "SELECT "+storage.articleColumns()+" FROM articles WHERE scopus_id IN (%s)",
+		scopusIDs, func(res *sql.Rows) error {
+			var article models.Article
+			err := res.Scan(&article.ScopusID, &article.Title, &article.Abstracts,
+				&article.PublicationDate, &article.CitationsCount, &article.PublicationType,
+				&article.PublicationTitle, &article.Doi)
+			found[article.ScopusID] = &article
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	if load.Authors {
+		err = storage.queryByArticles(db, `SELECT l.article_id, l.author_affiliations, a.scopus_id, a.initials,
+			a.indexed_name, a.surname, a.name
+			FROM article_author l JOIN authors a ON a.scopus_id = l.author_id
+			WHERE l.article_id IN (%s) ORDER BY l.article_id, l.author_position, l.author_id`,
+			ids, func(res *sql.Rows) error {
+				var articleID string
+				var author models.Author
+				err := res.Scan(&articleID, storage.affiliationsDest(&author.AffiliationID), &author.ScopusID,
+					&author.Initials, &author.IndexedName, &author.Surname, &author.Name)
+				article := found[articleID]
+				article.Authors = append(article.Authors, author)
+				return err
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if load.Affiliations {
+		err = storage.queryByArticles(db, `SELECT l.article_id, a.scopus_id, a.title, a.country, a.city, a.state,
+			a.postal_code, a.address
+			FROM article_affiliation l JOIN affiliations a ON a.scopus_id = l.affiliation_id
+			WHERE l.article_id IN (%s) ORDER BY l.article_id, a.scopus_id`,
+			ids, func(res *sql.Rows) error {
+				var articleID string
+				var affiliation models.Affiliation
+				err := res.Scan(&articleID, &affiliation.ScopusID, &affiliation.Title, &affiliation.Country,
+					&affiliation.City, &affiliation.State, &affiliation.PostalCode, &affiliation.Address)
+				article := found[articleID]
+				article.Affiliations = append(article.Affiliations, affiliation)
+				return err
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if load.Keywords {
+		err = storage.queryByArticles(db, `SELECT l.article_id, k.id, k.keyword
+			FROM article_keyword l JOIN keywords k ON k.id = l.keyword_id
+			WHERE l.article_id IN (%s) ORDER BY l.article_id, k.id`,
+			ids, func(res *sql.Rows) error {
+				var articleID string
+				var keyword models.Keyword
+				err := res.Scan(&articleID, &keyword.ID, &keyword.Value)
+				article := found[articleID]
+				article.Keywords = append(article.Keywords, keyword)
+				return err
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if load.SubjectAreas {
+		err = storage.queryByArticles(db, `SELECT l.article_id, s.scopus_id, s.title, s.code, s.description
+			FROM article_area l JOIN subject_areas s ON s.scopus_id = l.area_id
+			WHERE l.article_id IN (%s) ORDER BY l.article_id, s.scopus_id`,
+			ids, func(res *sql.Rows) error {
+				var articleID string
+				var area models.SubjectArea
+				err := res.Scan(&articleID, &area.ScopusID, &area.Title, &area.Code, &area.Description)
+				article := found[articleID]
+				article.SubjectAreas = append(article.SubjectAreas, area)
+				return err
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if load.References {
+		err = storage.loadReferences(db, ids, found)
+		if err != nil {
+			return nil, err
+		}
+	}
+	articles := make([]models.Article, 0, len(found))
+	for _, id := range scopusIDs {
+		if article, ok := found[id]; ok {
+			articles = append(articles, *article)
+			delete(found, id)
+		}
+	}
+	return articles, nil
+}
+
+func (storage *MySqlStorage) loadReferences(db *sql.DB, ids []string, found map[string]*models.Article) error {
+	referenceIDs := []string{}
+	err := storage.queryByArticles(db, `SELECT from_id, to_id FROM article_article
+		WHERE from_id IN (%s) ORDER BY from_id, to_id`,
+		ids, func(res *sql.Rows) error {
+			var articleID string
+			var reference models.Article
+			err := res.Scan(&articleID, &reference.ScopusID)
+			article := found[articleID]
+			article.References = append(article.References, reference)
+			referenceIDs = append(referenceIDs, reference.ScopusID)
+			return err
+		})
+	if err != nil || len(referenceIDs) == 0 {
+		return err
+	}
+	references, err := storage.GetArticles(referenceIDs, LoadOptions{})
+	if err != nil {
+		return err
+	}
+	stored := map[string]models.Article{}
+	for _, reference := range references {
+		stored[reference.ScopusID] = reference
+	}
+	for _, article := range found {
+		for i, reference := range article.References {
+			if complete, ok := stored[reference.ScopusID]; ok {
+				article.References[i] = complete
+			}
+		}
+	}
+	return nil
+}
+
+// queryByArticles runs the query for the articles and scans every row. The %s
+// of the query is replaced with the placeholders of the article IDs, which
+// are sent in chunks of at most maxQueryArgs.
+func (storage *MySqlStorage) queryByArticles(db *sql.DB, query string, scopusIDs []string,
+	scan func(res *sql.Rows) error) error {
+	for start := 0; start < len(scopusIDs); start += maxQueryArgs {
+		end := start + maxQueryArgs
+		if end > len(scopusIDs) {
+			end = len(scopusIDs)
+		}
+		args := make([]interface{}, end-start)
+		for i, id := range scopusIDs[start:end] {
+			args[i] = id
+		}
+		res, err := db.Query(storage.rebind(fmt.Sprintf(query, placeholders(end-start))), args...)
+		if err != nil {
+			return err
+		}
+		for res.Next() {
+			err = scan(res)
+			if err != nil {
+				res.Close()
+				return err
+			}
+		}
+		err = res.Err()
+		res.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
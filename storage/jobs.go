@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"../models"
+)
+
+const createJobsTable = `CREATE TABLE IF NOT EXISTS jobs (
+	id VARCHAR(32),
+	source_name TEXT,
+	fields TEXT,
+	state VARCHAR(16),
+	pages_planned INTEGER,
+	articles_fetched INTEGER,
+	articles_stored INTEGER,
+	errors_count INTEGER,
+	last_error TEXT,
+	created_at BIGINT,
+	updated_at BIGINT,
+	PRIMARY KEY (id)
+)`
+
+// execer runs the statements of the methods shared by the storage and its
+// transactions
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (storage *MySqlStorage) CreateJob(job models.Job) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	return storage.createJob(db, job)
+}
+
+// CreateJobWithTasks registers the job with its splits and first tasks in a
+// single transaction, so a job is never left without its tasks. The visited
+// articles are the ones the job starts from.
+func (storage *MySqlStorage) CreateJobWithTasks(job models.Job, splits []models.JobSplit, tasks []models.Task,
+	visited []string) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = storage.createJob(tx, job)
+	if err != nil {
+		return err
+	}
+	for _, split := range splits {
+		err = storage.createJobSplit(tx, split)
+		if err != nil {
+			return err
+		}
+	}
+	for _, task := range tasks {
+		err = storage.createTask(tx, task)
+		if err != nil {
+			return err
+		}
+	}
+	for _, scopusID := range visited {
+		_, err = storage.markVisited(tx, job.ID, scopusID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (storage *MySqlStorage) createJob(db execer, job models.Job) error {
+	fields, err := json.Marshal(job.Fields)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.rebind("INSERT INTO jobs VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		job.ID, job.SourceName, string(fields), job.State, job.PagesPlanned, job.ArticlesFetched,
+		job.ArticlesStored, job.Errors, job.LastError, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (storage *MySqlStorage) GetJob(id string) (models.Job, error) {
+	var job models.Job
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return job, err
+	}
+	res, err := db.Query(storage.rebind(`SELECT id, source_name, fields, state, pages_planned, articles_fetched,
+		articles_stored, errors_count, last_error, created_at, updated_at,
+		(SELECT COUNT(*) FROM crawl_tasks WHERE job_id = jobs.id AND state IN (?, ?))
+		FROM jobs WHERE id = ?`), models.TaskPending, models.TaskLeased, id)
+	if err != nil {
+		return job, err
+	}
+	defer res.Close()
+	for res.Next() {
+		var fields string
+		err = res.Scan(&job.ID, &job.SourceName, &fields, &job.State, &job.PagesPlanned,
+			&job.ArticlesFetched, &job.ArticlesStored, &job.Errors, &job.LastError,
+			&job.CreatedAt, &job.UpdatedAt, &job.PendingTasks)
+		if err != nil {
+			return job, err
+		}
+		err = json.Unmarshal([]byte(fields), &job.Fields)
+		if err != nil {
+			return job, err
+		}
+		return job, nil
+	}
+	return job, ErrNotFound
+}
+
+func (storage *MySqlStorage) UpdateJobState(id string, state string) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.rebind(`UPDATE jobs SET state = ?, updated_at = ? WHERE id = ?`), state, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// StartJob moves a queued job to the running state, jobs in other states are left as is
+func (storage *MySqlStorage) StartJob(id string) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.rebind(`UPDATE jobs SET state = ?, updated_at = ? WHERE id = ? AND state = ?`),
+		models.JobRunning, time.Now().Unix(), id, models.JobQueued)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateJobProgress adds the counters of progress to the ones stored for the job
+func (storage *MySqlStorage) UpdateJobProgress(id string, progress models.JobProgress) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	query := `UPDATE jobs SET pages_planned = pages_planned + ?, articles_fetched = articles_fetched + ?,
+		articles_stored = articles_stored + ?, errors_count = errors_count + ?, updated_at = ?`
+	args := []interface{}{progress.PagesPlanned, progress.ArticlesFetched, progress.ArticlesStored,
+		progress.Errors, time.Now().Unix()}
+	if progress.LastError != "" {
+		query += ", last_error = ?"
+		args = append(args, progress.LastError)
+	}
+	query += " WHERE id = ?"
+	args = append(args, id)
+	_, err = db.Exec(storage.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
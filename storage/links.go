@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+const createArticleAuthorsTable = `CREATE TABLE IF NOT EXISTS article_author(
+	author_id VARCHAR(20) NOT NULL,
+	article_id VARCHAR(20) NOT NULL,
+	author_affiliations TEXT,
+	PRIMARY KEY (author_id, article_id),
+	FOREIGN KEY (author_id) REFERENCES authors (scopus_id) ON DELETE CASCADE,
+	FOREIGN KEY (article_id) REFERENCES articles (scopus_id) ON DELETE CASCADE
+)`
+
+const createArticleAuthorsTablePostgres = `CREATE TABLE IF NOT EXISTS article_author(
+	author_id VARCHAR(20) NOT NULL,
+	article_id VARCHAR(20) NOT NULL,
+	author_affiliations TEXT[],
+	PRIMARY KEY (author_id, article_id),
+	FOREIGN KEY (author_id) REFERENCES authors (scopus_id) ON DELETE CASCADE,
+	FOREIGN KEY (article_id) REFERENCES articles (scopus_id) ON DELETE CASCADE
+)`
+
+// Both ends of a reference may be absent in the articles table: references
+// are not retrieved and citing articles are linked before they are fetched.
+const createArticleArticlesTable = `CREATE TABLE IF NOT EXISTS article_article(
+	from_id VARCHAR(20) NOT NULL,
+	to_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (from_id, to_id)
+)`
+
+const createArticleArticlesTableMysql = `CREATE TABLE IF NOT EXISTS article_article(
+	from_id VARCHAR(20) NOT NULL,
+	to_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (from_id, to_id),
+	KEY (to_id)
+)`
+
+const createArticleAreasTable = `CREATE TABLE IF NOT EXISTS article_area(
+	area_id VARCHAR(20) NOT NULL,
+	article_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (area_id, article_id),
+	FOREIGN KEY (area_id) REFERENCES subject_areas (scopus_id) ON DELETE CASCADE,
+	FOREIGN KEY (article_id) REFERENCES articles (scopus_id) ON DELETE CASCADE
+)`
+
+const createArticleKeywordsTable = `CREATE TABLE IF NOT EXISTS article_keyword(
+	keyword_id VARCHAR(20) NOT NULL,
+	article_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (keyword_id, article_id),
+	FOREIGN KEY (keyword_id) REFERENCES keywords (id) ON DELETE CASCADE,
+	FOREIGN KEY (article_id) REFERENCES articles (scopus_id) ON DELETE CASCADE
+)`
+
+const createArticleAffiliationsTable = `CREATE TABLE IF NOT EXISTS article_affiliation(
+	affiliation_id VARCHAR(20) NOT NULL,
+	article_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (affiliation_id, article_id),
+	FOREIGN KEY (affiliation_id) REFERENCES affiliations (scopus_id) ON DELETE CASCADE,
+	FOREIGN KEY (article_id) REFERENCES articles (scopus_id) ON DELETE CASCADE
+)`
+
+const createArticleAffiliationsIndex = `CREATE INDEX IF NOT EXISTS article_affiliation_article
+	ON article_affiliation (article_id)`
+
+// MySQL indexes the foreign keys by itself
+var linkIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS article_author_article ON article_author (article_id)`,
+	`CREATE INDEX IF NOT EXISTS article_article_to ON article_article (to_id)`,
+	`CREATE INDEX IF NOT EXISTS article_area_article ON article_area (article_id)`,
+	`CREATE INDEX IF NOT EXISTS article_keyword_article ON article_keyword (article_id)`,
+}
+
+// linkTable describes a link table for rebuildLinkTables
+type linkTable struct {
+	name    string
+	columns []string
+	// parents maps the columns to the queries of the keys they reference
+	parents map[string]string
+}
+
+const (
+	selectArticleIDs = "SELECT scopus_id FROM articles"
+	selectAuthorIDs  = "SELECT scopus_id FROM authors"
+	selectAreaIDs    = "SELECT scopus_id FROM subject_areas"
+	selectKeywordIDs = "SELECT id FROM keywords"
+)
+
+var linkTables = []linkTable{
+	{"article_author", []string{"author_id", "article_id", "author_affiliations"},
+		map[string]string{"author_id": selectAuthorIDs, "article_id": selectArticleIDs}},
+	{"article_article", []string{"from_id", "to_id"}, nil},
+	{"article_area", []string{"area_id", "article_id"},
+		map[string]string{"area_id": selectAreaIDs, "article_id": selectArticleIDs}},
+	{"article_keyword", []string{"keyword_id", "article_id"},
+		map[string]string{"keyword_id": selectKeywordIDs, "article_id": selectArticleIDs}},
+}
+
+func (storage *MySqlStorage) linkSchema() []string {
+	switch storage.DBType {
+	case MYSQL:
+		return []string{createArticleAuthorsTable, createArticleArticlesTableMysql, createArticleAreasTable,
+			createArticleKeywordsTable}
+	case POSTGRES:
+		return append([]string{createArticleAuthorsTablePostgres, createArticleArticlesTable,
+			createArticleAreasTable, createArticleKeywordsTable}, linkIndexes...)
+	default:
+		return append([]string{createArticleAuthorsTable, createArticleArticlesTable, createArticleAreasTable,
+			createArticleKeywordsTable}, linkIndexes...)
+	}
+}
+
+// CreateArticleReference links the article to the one it references
+func (storage *MySqlStorage) CreateArticleReference(articleID string, referenceID string) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.insertIgnoreQuery("article_article", "from_id", "to_id"), articleID, referenceID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// rebuildLinkTables recreates the link tables with the schema statements.
+// Duplicate links are dropped, as well as the links to the parents which are
+// not in the storage.
+func (storage *MySqlStorage) rebuildLinkTables(tx *sql.Tx, tables []linkTable, schema []string) error {
+	for _, table := range tables {
+		_, err := tx.Exec("CREATE TABLE " + table.name + "_old AS SELECT * FROM " + table.name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DROP TABLE " + table.name)
+		if err != nil {
+			return err
+		}
+	}
+	for _, statement := range schema {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	for _, table := range tables {
+		conditions := []string{}
+		for _, column := range table.columns {
+			if parent, ok := table.parents[column]; ok {
+				conditions = append(conditions, column+" IN ("+parent+")")
+			} else if column != "author_affiliations" {
+				conditions = append(conditions, column+" IS NOT NULL")
+			}
+		}
+		selectQuery := "SELECT " + strings.Join(table.columns, ", ") + " FROM " + table.name + "_old WHERE " +
+			strings.Join(conditions, " AND ")
+		_, err := tx.Exec(storage.insertIgnoreSelectQuery(table.name, table.columns, selectQuery))
+		if err != nil {
+			return err
+		}
+		before, err := countRows(tx, table.name+"_old")
+		if err != nil {
+			return err
+		}
+		after, err := countRows(tx, table.name)
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: %d rows removed", table.name, before-after)
+		_, err = tx.Exec("DROP TABLE " + table.name + "_old")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func countRows(tx *sql.Tx, table string) (int, error) {
+	res, err := tx.Query("SELECT COUNT(*) FROM " + table)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	return checkCount(res)
+}
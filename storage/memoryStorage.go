@@ -0,0 +1,1015 @@
+package storage
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"../models"
+)
+
+// MemoryStorage keeps everything in memory. It is used in tests and for dry
+// runs, which show what a crawl would write without touching a database.
+type MemoryStorage struct {
+	mutex                 sync.RWMutex
+	articles              map[string]models.Article
+	authors               map[string]models.Author
+	authorProfiles        map[string]models.Author
+	affiliations          map[string]models.Affiliation
+	retrievedAffiliations map[string]bool
+	keywords              map[string]models.Keyword
+	subjectAreas          map[string]models.SubjectArea
+	articleAuthors        []ArticleAuthorLink
+	articleAffiliations   []Link
+	articleArticles       []Link
+	articleAreas          []Link
+	articleKeywords       []Link
+	// links maps the keys of the link rows to their index, the same link is kept once
+	links            map[string]int
+	finishedRequests map[string]FinishedRequest
+	failedRequests   map[string]models.FailedRequest
+	jobs             map[string]models.Job
+	jobSplits        []models.JobSplit
+	tasks            []memoryTask
+	taskKeys         map[string]bool
+	visited          map[string]bool
+}
+
+// Link is a row of the article_affiliation, article_article, article_area and
+// article_keyword tables
+type Link struct {
+	From string
+	To   string
+}
+
+// ArticleAuthorLink is a row of the article_author table
+type ArticleAuthorLink struct {
+	AuthorID           string
+	ArticleID          string
+	AuthorAffiliations []string
+	AuthorPosition     int
+}
+
+type FinishedRequest struct {
+	Request   string
+	Response  string
+	CreatedAt int64
+}
+
+type memoryTask struct {
+	models.Task
+	LeaseOwner string
+	LeaseUntil int64
+	LastError  string
+}
+
+// MemorySnapshot is a copy of the MemoryStorage content
+type MemorySnapshot struct {
+	Articles            []models.Article
+	Authors             []models.Author
+	AuthorProfiles      []models.Author
+	Affiliations        []models.Affiliation
+	Keywords            []models.Keyword
+	SubjectAreas        []models.SubjectArea
+	ArticleAuthors      []ArticleAuthorLink
+	ArticleAffiliations []Link
+	ArticleArticles     []Link
+	ArticleAreas        []Link
+	ArticleKeywords     []Link
+	FinishedRequests    []FinishedRequest
+	FailedRequests      []models.FailedRequest
+	Jobs                []models.Job
+	JobSplits           []models.JobSplit
+	Tasks               []models.Task
+}
+
+var _ GenericStorage = (*MemoryStorage)(nil)
+
+func NewMemoryStorage() *MemoryStorage {
+	storage := &MemoryStorage{}
+	storage.Init()
+	return storage
+}
+
+// Init drops all the data
+func (storage *MemoryStorage) Init() error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.articles = map[string]models.Article{}
+	storage.authors = map[string]models.Author{}
+	storage.authorProfiles = map[string]models.Author{}
+	storage.affiliations = map[string]models.Affiliation{}
+	storage.retrievedAffiliations = map[string]bool{}
+	storage.keywords = map[string]models.Keyword{}
+	storage.subjectAreas = map[string]models.SubjectArea{}
+	storage.articleAuthors = nil
+	storage.articleAffiliations = nil
+	storage.articleArticles = nil
+	storage.articleAreas = nil
+	storage.articleKeywords = nil
+	storage.links = map[string]int{}
+	storage.finishedRequests = map[string]FinishedRequest{}
+	storage.failedRequests = map[string]models.FailedRequest{}
+	storage.jobs = map[string]models.Job{}
+	storage.jobSplits = nil
+	storage.tasks = nil
+	storage.taskKeys = map[string]bool{}
+	storage.visited = map[string]bool{}
+	return nil
+}
+
+// Snapshot copies the current content of the storage
+func (storage *MemoryStorage) Snapshot() MemorySnapshot {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	var snapshot MemorySnapshot
+	for _, article := range storage.articles {
+		snapshot.Articles = append(snapshot.Articles, article)
+	}
+	sort.Slice(snapshot.Articles, func(i, j int) bool {
+		return snapshot.Articles[i].ScopusID < snapshot.Articles[j].ScopusID
+	})
+	for _, author := range storage.authors {
+		snapshot.Authors = append(snapshot.Authors, author)
+	}
+	sort.Slice(snapshot.Authors, func(i, j int) bool {
+		return snapshot.Authors[i].ScopusID < snapshot.Authors[j].ScopusID
+	})
+	for _, profile := range storage.authorProfiles {
+		snapshot.AuthorProfiles = append(snapshot.AuthorProfiles, profile)
+	}
+	sort.Slice(snapshot.AuthorProfiles, func(i, j int) bool {
+		return snapshot.AuthorProfiles[i].ScopusID < snapshot.AuthorProfiles[j].ScopusID
+	})
+	for _, affiliation := range storage.affiliations {
+		snapshot.Affiliations = append(snapshot.Affiliations, affiliation)
+	}
+	sort.Slice(snapshot.Affiliations, func(i, j int) bool {
+		return snapshot.Affiliations[i].ScopusID < snapshot.Affiliations[j].ScopusID
+	})
+	for _, keyword := range storage.keywords {
+		snapshot.Keywords = append(snapshot.Keywords, keyword)
+	}
+	sort.Slice(snapshot.Keywords, func(i, j int) bool {
+		return snapshot.Keywords[i].ID < snapshot.Keywords[j].ID
+	})
+	for _, area := range storage.subjectAreas {
+		snapshot.SubjectAreas = append(snapshot.SubjectAreas, area)
+	}
+	sort.Slice(snapshot.SubjectAreas, func(i, j int) bool {
+		return snapshot.SubjectAreas[i].ScopusID < snapshot.SubjectAreas[j].ScopusID
+	})
+	for _, link := range storage.articleAuthors {
+		link.AuthorAffiliations = append([]string{}, link.AuthorAffiliations...)
+		snapshot.ArticleAuthors = append(snapshot.ArticleAuthors, link)
+	}
+	snapshot.ArticleAffiliations = append(snapshot.ArticleAffiliations, storage.articleAffiliations...)
+	snapshot.ArticleArticles = append(snapshot.ArticleArticles, storage.articleArticles...)
+	snapshot.ArticleAreas = append(snapshot.ArticleAreas, storage.articleAreas...)
+	snapshot.ArticleKeywords = append(snapshot.ArticleKeywords, storage.articleKeywords...)
+	for _, finished := range storage.finishedRequests {
+		snapshot.FinishedRequests = append(snapshot.FinishedRequests, finished)
+	}
+	sort.Slice(snapshot.FinishedRequests, func(i, j int) bool {
+		return snapshot.FinishedRequests[i].CreatedAt < snapshot.FinishedRequests[j].CreatedAt
+	})
+	snapshot.FailedRequests = storage.sortedFailedRequests()
+	for _, job := range storage.jobs {
+		snapshot.Jobs = append(snapshot.Jobs, storage.jobWithPending(job))
+	}
+	sort.Slice(snapshot.Jobs, func(i, j int) bool {
+		return snapshot.Jobs[i].CreatedAt < snapshot.Jobs[j].CreatedAt
+	})
+	snapshot.JobSplits = append(snapshot.JobSplits, storage.jobSplits...)
+	for _, task := range storage.tasks {
+		snapshot.Tasks = append(snapshot.Tasks, task.Task)
+	}
+	return snapshot
+}
+
+// Dump writes the snapshot of the storage as JSON
+func (storage *MemoryStorage) Dump(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(storage.Snapshot())
+}
+
+func (storage *MemoryStorage) DumpFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return storage.Dump(file)
+}
+
+func authorValues(author models.Author) map[string]string {
+	return map[string]string{
+		"scopus_id":      author.ScopusID,
+		"initials":       author.Initials,
+		"indexed_name":   author.IndexedName,
+		"surname":        author.Surname,
+		"name":           author.Name,
+		"affiliation_id": strings.Join(author.AffiliationID, ","),
+	}
+}
+
+func affiliationValues(affiliation models.Affiliation) map[string]string {
+	return map[string]string{
+		"scopus_id":   affiliation.ScopusID,
+		"title":       affiliation.Title,
+		"country":     affiliation.Country,
+		"city":        affiliation.City,
+		"state":       affiliation.State,
+		"postal_code": affiliation.PostalCode,
+		"address":     affiliation.Address,
+	}
+}
+
+func articleValues(article models.Article) map[string]string {
+	return map[string]string{
+		"scopus_id":         article.ScopusID,
+		"title":             article.Title,
+		"abstracts":         article.Abstracts,
+		"publication_date":  article.PublicationDate,
+		"citations_count":   strconv.Itoa(article.CitationsCount),
+		"publication_type":  article.PublicationType,
+		"publication_title": article.PublicationTitle,
+		"doi":               article.Doi,
+	}
+}
+
+func subjectAreaValues(area models.SubjectArea) map[string]string {
+	return map[string]string{
+		"scopus_id":   area.ScopusID,
+		"title":       area.Title,
+		"code":        area.Code,
+		"description": area.Description,
+	}
+}
+
+func keywordValues(keyword models.Keyword) map[string]string {
+	return map[string]string{
+		"id":      keyword.ID,
+		"keyword": keyword.Value,
+	}
+}
+
+func (storage *MemoryStorage) CreateAuthor(author models.Author) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.createAuthor(author)
+	return nil
+}
+
+// createAuthor keeps the columns of the authors table only
+func (storage *MemoryStorage) createAuthor(author models.Author) {
+	storage.authors[author.ScopusID] = models.Author{
+		ScopusID:      author.ScopusID,
+		Initials:      author.Initials,
+		IndexedName:   author.IndexedName,
+		Surname:       author.Surname,
+		Name:          author.Name,
+		AffiliationID: append([]string{}, author.AffiliationID...),
+	}
+}
+
+// CreateAuthorProfile keeps the whole author as the profile
+func (storage *MemoryStorage) CreateAuthorProfile(author models.Author) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.createAuthor(author)
+	for _, area := range author.SubjectAreas {
+		storage.subjectAreas[area.ScopusID] = area
+	}
+	author.Affiliation = models.Affiliation{}
+	author.AffiliationID = nil
+	storage.authorProfiles[author.ScopusID] = author
+	return nil
+}
+
+func (storage *MemoryStorage) UpdateAuthor(author models.Author) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	if _, ok := storage.authors[author.ScopusID]; ok {
+		storage.createAuthor(author)
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) GetAuthor(scopusID string) (models.Author, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	author, ok := storage.authors[scopusID]
+	if !ok {
+		return author, ErrNotFound
+	}
+	if profile, ok := storage.authorProfiles[scopusID]; ok {
+		author.HIndex = profile.HIndex
+		author.DocumentCount = profile.DocumentCount
+		author.CitedByCount = profile.CitedByCount
+		author.CitationCount = profile.CitationCount
+		author.Orcid = profile.Orcid
+		author.NameVariants = append([]string(nil), profile.NameVariants...)
+		author.SubjectAreas = append([]models.SubjectArea(nil), profile.SubjectAreas...)
+		author.AffiliationHistory = append([]string(nil), profile.AffiliationHistory...)
+	}
+	return author, nil
+}
+
+func (storage *MemoryStorage) SearchAuthors(filter Filter) ([]models.Author, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	records := make([]models.Author, 0, len(storage.authors))
+	values := make([]map[string]string, 0, len(storage.authors))
+	for _, record := range storage.authors {
+		records = append(records, record)
+		values = append(values, authorValues(record))
+	}
+	selected, err := filter.apply("authors", values)
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]models.Author, len(selected))
+	for i, index := range selected {
+		authors[i] = records[index]
+	}
+	return authors, nil
+}
+
+func (storage *MemoryStorage) DeleteAuthor(scopusID string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.authors, scopusID)
+	return nil
+}
+
+func (storage *MemoryStorage) CreateAffiliation(affiliation models.Affiliation) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.affiliations[affiliation.ScopusID] = affiliation
+	storage.retrievedAffiliations[affiliation.ScopusID] = true
+	return nil
+}
+
+func (storage *MemoryStorage) CheckAffiliation(afid string) (bool, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	return storage.retrievedAffiliations[afid], nil
+}
+
+func (storage *MemoryStorage) UpdateAffiliation(affiliation models.Affiliation) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	if _, ok := storage.affiliations[affiliation.ScopusID]; ok {
+		storage.affiliations[affiliation.ScopusID] = affiliation
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) GetAffiliation(scopusID string) (models.Affiliation, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	affiliation, ok := storage.affiliations[scopusID]
+	if !ok {
+		return affiliation, ErrNotFound
+	}
+	return affiliation, nil
+}
+
+func (storage *MemoryStorage) SearchAffiliations(filter Filter) ([]models.Affiliation, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	records := make([]models.Affiliation, 0, len(storage.affiliations))
+	values := make([]map[string]string, 0, len(storage.affiliations))
+	for _, record := range storage.affiliations {
+		records = append(records, record)
+		values = append(values, affiliationValues(record))
+	}
+	selected, err := filter.apply("affiliations", values)
+	if err != nil {
+		return nil, err
+	}
+	affiliations := make([]models.Affiliation, len(selected))
+	for i, index := range selected {
+		affiliations[i] = records[index]
+	}
+	return affiliations, nil
+}
+
+func (storage *MemoryStorage) DeleteAffiliation(scopusID string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.affiliations, scopusID)
+	return nil
+}
+
+// CreateArticle writes the article with its linked records the same way the
+// SQL storage does
+func (storage *MemoryStorage) CreateArticle(article models.Article) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.createArticle(article)
+	return nil
+}
+
+func (storage *MemoryStorage) CreateArticles(articles []models.Article) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	for _, article := range articles {
+		storage.createArticle(article)
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) createArticle(article models.Article) {
+	storage.articles[article.ScopusID] = flatArticle(article)
+	for _, affiliation := range article.Affiliations {
+		if _, ok := storage.affiliations[affiliation.ScopusID]; ok {
+			continue
+		}
+		storage.affiliations[affiliation.ScopusID] = affiliation
+	}
+	for _, affiliation := range article.Affiliations {
+		storage.articleAffiliations = storage.addLink(storage.articleAffiliations, "article_affiliation",
+			Link{affiliation.ScopusID, article.ScopusID})
+	}
+	for _, area := range article.SubjectAreas {
+		storage.subjectAreas[area.ScopusID] = area
+		storage.articleAreas = storage.addLink(storage.articleAreas, "article_area",
+			Link{area.ScopusID, article.ScopusID})
+	}
+	for position, author := range article.Authors {
+		storage.createAuthor(author)
+		link := ArticleAuthorLink{
+			AuthorID:           author.ScopusID,
+			ArticleID:          article.ScopusID,
+			AuthorAffiliations: append([]string{}, author.AffiliationID...),
+			AuthorPosition:     position,
+		}
+		key := "article_author " + author.ScopusID + " " + article.ScopusID
+		if i, ok := storage.links[key]; ok {
+			storage.articleAuthors[i] = link
+			continue
+		}
+		storage.links[key] = len(storage.articleAuthors)
+		storage.articleAuthors = append(storage.articleAuthors, link)
+	}
+	for _, keyword := range article.Keywords {
+		storage.keywords[keyword.ID] = keyword
+		storage.articleKeywords = storage.addLink(storage.articleKeywords, "article_keyword",
+			Link{keyword.ID, article.ScopusID})
+	}
+	for _, reference := range article.References {
+		storage.articleArticles = storage.addLink(storage.articleArticles, "article_article",
+			Link{article.ScopusID, reference.ScopusID})
+	}
+}
+
+// addLink appends the link to the rows of the table unless it is there already
+func (storage *MemoryStorage) addLink(links []Link, table string, link Link) []Link {
+	key := table + " " + link.From + " " + link.To
+	if _, ok := storage.links[key]; ok {
+		return links
+	}
+	storage.links[key] = len(links)
+	return append(links, link)
+}
+
+// flatArticle keeps the columns of the articles table only
+func flatArticle(article models.Article) models.Article {
+	return models.Article{
+		ScopusID:         article.ScopusID,
+		Title:            article.Title,
+		Abstracts:        article.Abstracts,
+		PublicationDate:  article.PublicationDate,
+		CitationsCount:   article.CitationsCount,
+		PublicationType:  article.PublicationType,
+		PublicationTitle: article.PublicationTitle,
+		Doi:              article.Doi,
+	}
+}
+
+func (storage *MemoryStorage) UpdateArticle(article models.Article) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	if _, ok := storage.articles[article.ScopusID]; ok {
+		storage.articles[article.ScopusID] = flatArticle(article)
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) GetArticle(scopusID string, load LoadOptions) (models.Article, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	article, ok := storage.articles[scopusID]
+	if !ok {
+		return article, ErrNotFound
+	}
+	return storage.loadArticle(article, load), nil
+}
+
+// GetArticles loads the relations in the order of the SQL storage: authors by
+// their position, the others by their IDs
+func (storage *MemoryStorage) GetArticles(scopusIDs []string, load LoadOptions) ([]models.Article, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	articles := []models.Article{}
+	seen := map[string]bool{}
+	for _, scopusID := range scopusIDs {
+		article, ok := storage.articles[scopusID]
+		if !ok || seen[scopusID] {
+			continue
+		}
+		seen[scopusID] = true
+		articles = append(articles, storage.loadArticle(article, load))
+	}
+	return articles, nil
+}
+
+func (storage *MemoryStorage) loadArticle(article models.Article, load LoadOptions) models.Article {
+	if load.Authors {
+		links := []ArticleAuthorLink{}
+		for _, link := range storage.articleAuthors {
+			if link.ArticleID == article.ScopusID {
+				links = append(links, link)
+			}
+		}
+		sort.SliceStable(links, func(i, j int) bool {
+			return links[i].AuthorPosition < links[j].AuthorPosition
+		})
+		for _, link := range links {
+			author, ok := storage.authors[link.AuthorID]
+			if !ok {
+				continue
+			}
+			author.AffiliationID = append([]string{}, link.AuthorAffiliations...)
+			article.Authors = append(article.Authors, author)
+		}
+	}
+	if load.Affiliations {
+		for _, id := range linkedIDs(storage.articleAffiliations, article.ScopusID) {
+			if affiliation, ok := storage.affiliations[id]; ok {
+				article.Affiliations = append(article.Affiliations, affiliation)
+			}
+		}
+	}
+	if load.Keywords {
+		for _, id := range linkedIDs(storage.articleKeywords, article.ScopusID) {
+			if keyword, ok := storage.keywords[id]; ok {
+				article.Keywords = append(article.Keywords, keyword)
+			}
+		}
+	}
+	if load.SubjectAreas {
+		for _, id := range linkedIDs(storage.articleAreas, article.ScopusID) {
+			if area, ok := storage.subjectAreas[id]; ok {
+				article.SubjectAreas = append(article.SubjectAreas, area)
+			}
+		}
+	}
+	if load.References {
+		referenceIDs := []string{}
+		for _, link := range storage.articleArticles {
+			if link.From == article.ScopusID {
+				referenceIDs = append(referenceIDs, link.To)
+			}
+		}
+		sort.Strings(referenceIDs)
+		for _, id := range referenceIDs {
+			reference, ok := storage.articles[id]
+			if !ok {
+				reference = models.Article{ScopusID: id}
+			}
+			article.References = append(article.References, reference)
+		}
+	}
+	return article
+}
+
+// linkedIDs returns the sorted IDs linked to the article by the links whose To
+// is the article
+func linkedIDs(links []Link, articleID string) []string {
+	ids := []string{}
+	for _, link := range links {
+		if link.To == articleID {
+			ids = append(ids, link.From)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (storage *MemoryStorage) SearchArticles(filter Filter) ([]models.Article, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	records := make([]models.Article, 0, len(storage.articles))
+	values := make([]map[string]string, 0, len(storage.articles))
+	for _, record := range storage.articles {
+		records = append(records, record)
+		values = append(values, articleValues(record))
+	}
+	selected, err := filter.apply("articles", values)
+	if err != nil {
+		return nil, err
+	}
+	articles := make([]models.Article, len(selected))
+	for i, index := range selected {
+		articles[i] = records[index]
+	}
+	return articles, nil
+}
+
+func (storage *MemoryStorage) DeleteArticle(scopusID string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.articles, scopusID)
+	return nil
+}
+
+func (storage *MemoryStorage) CreateSubjectArea(area models.SubjectArea) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.subjectAreas[area.ScopusID] = area
+	return nil
+}
+
+func (storage *MemoryStorage) UpdateSubjectArea(area models.SubjectArea) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	if _, ok := storage.subjectAreas[area.ScopusID]; ok {
+		storage.subjectAreas[area.ScopusID] = area
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) GetSubjectArea(scopusID string) (models.SubjectArea, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	area, ok := storage.subjectAreas[scopusID]
+	if !ok {
+		return area, ErrNotFound
+	}
+	return area, nil
+}
+
+func (storage *MemoryStorage) SearchSubjectAreas(filter Filter) ([]models.SubjectArea, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	records := make([]models.SubjectArea, 0, len(storage.subjectAreas))
+	values := make([]map[string]string, 0, len(storage.subjectAreas))
+	for _, record := range storage.subjectAreas {
+		records = append(records, record)
+		values = append(values, subjectAreaValues(record))
+	}
+	selected, err := filter.apply("subject_areas", values)
+	if err != nil {
+		return nil, err
+	}
+	areas := make([]models.SubjectArea, len(selected))
+	for i, index := range selected {
+		areas[i] = records[index]
+	}
+	return areas, nil
+}
+
+func (storage *MemoryStorage) DeleteSubjectArea(scopusID string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.subjectAreas, scopusID)
+	return nil
+}
+
+func (storage *MemoryStorage) CreateKeyword(keyword models.Keyword) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.keywords[keyword.ID] = keyword
+	return nil
+}
+
+func (storage *MemoryStorage) UpdateKeyword(keyword models.Keyword) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	if _, ok := storage.keywords[keyword.ID]; ok {
+		storage.keywords[keyword.ID] = keyword
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) GetKeyword(id string) (models.Keyword, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	keyword, ok := storage.keywords[id]
+	if !ok {
+		return keyword, ErrNotFound
+	}
+	return keyword, nil
+}
+
+func (storage *MemoryStorage) SearchKeywords(filter Filter) ([]models.Keyword, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	records := make([]models.Keyword, 0, len(storage.keywords))
+	values := make([]map[string]string, 0, len(storage.keywords))
+	for _, record := range storage.keywords {
+		records = append(records, record)
+		values = append(values, keywordValues(record))
+	}
+	selected, err := filter.apply("keywords", values)
+	if err != nil {
+		return nil, err
+	}
+	keywords := make([]models.Keyword, len(selected))
+	for i, index := range selected {
+		keywords[i] = records[index]
+	}
+	return keywords, nil
+}
+
+func (storage *MemoryStorage) DeleteKeyword(id string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.keywords, id)
+	return nil
+}
+
+func (storage *MemoryStorage) CreateArticleReference(articleID string, referenceID string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.articleArticles = storage.addLink(storage.articleArticles, "article_article", Link{articleID, referenceID})
+	return nil
+}
+
+func (storage *MemoryStorage) CreateFinishedRequest(request string, response string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.finishedRequests[hashRequest(request)] = FinishedRequest{request, response, time.Now().Unix()}
+	return nil
+}
+
+func (storage *MemoryStorage) GetFinishedRequest(request string, maxAge time.Duration) (string, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	finished, ok := storage.finishedRequests[hashRequest(request)]
+	if !ok || (maxAge > 0 && finished.CreatedAt < time.Now().Add(-maxAge).Unix()) {
+		return "", ErrNotFound
+	}
+	return finished.Response, nil
+}
+
+func (storage *MemoryStorage) CreateFailedRequest(request models.FailedRequest) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.failedRequests[hashRequest(request.Request)] = request
+	return nil
+}
+
+func (storage *MemoryStorage) GetFailedRequests() ([]models.FailedRequest, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	return storage.sortedFailedRequests(), nil
+}
+
+func (storage *MemoryStorage) sortedFailedRequests() []models.FailedRequest {
+	var requests []models.FailedRequest
+	for _, request := range storage.failedRequests {
+		requests = append(requests, request)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt < requests[j].CreatedAt
+	})
+	return requests
+}
+
+func (storage *MemoryStorage) CreateJob(job models.Job) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.jobs[job.ID] = job
+	return nil
+}
+
+func (storage *MemoryStorage) CreateJobWithTasks(job models.Job, splits []models.JobSplit, tasks []models.Task,
+	visited []string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.jobs[job.ID] = job
+	for _, split := range splits {
+		storage.createJobSplit(split)
+	}
+	for _, task := range tasks {
+		storage.createTask(task)
+	}
+	for _, scopusID := range visited {
+		storage.visited[job.ID+"|"+scopusID] = true
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) GetJob(id string) (models.Job, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	job, ok := storage.jobs[id]
+	if !ok {
+		return job, ErrNotFound
+	}
+	return storage.jobWithPending(job), nil
+}
+
+func (storage *MemoryStorage) jobWithPending(job models.Job) models.Job {
+	job.PendingTasks = storage.countActiveTasks(job.ID)
+	return job
+}
+
+func (storage *MemoryStorage) UpdateJobState(id string, state string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	job, ok := storage.jobs[id]
+	if ok {
+		job.State = state
+		job.UpdatedAt = time.Now().Unix()
+		storage.jobs[id] = job
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) StartJob(id string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	job, ok := storage.jobs[id]
+	if ok && job.State == models.JobQueued {
+		job.State = models.JobRunning
+		job.UpdatedAt = time.Now().Unix()
+		storage.jobs[id] = job
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) UpdateJobProgress(id string, progress models.JobProgress) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	job, ok := storage.jobs[id]
+	if !ok {
+		return nil
+	}
+	job.PagesPlanned += progress.PagesPlanned
+	job.ArticlesFetched += progress.ArticlesFetched
+	job.ArticlesStored += progress.ArticlesStored
+	job.Errors += progress.Errors
+	if progress.LastError != "" {
+		job.LastError = progress.LastError
+	}
+	job.UpdatedAt = time.Now().Unix()
+	storage.jobs[id] = job
+	return nil
+}
+
+func (storage *MemoryStorage) CreateJobSplit(split models.JobSplit) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.createJobSplit(split)
+	return nil
+}
+
+func (storage *MemoryStorage) createJobSplit(split models.JobSplit) {
+	for _, existing := range storage.jobSplits {
+		if existing.JobID == split.JobID && existing.ID == split.ID {
+			return
+		}
+	}
+	split.Children = nil
+	storage.jobSplits = append(storage.jobSplits, split)
+}
+
+func (storage *MemoryStorage) UpdateJobSplit(split models.JobSplit) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	for i, existing := range storage.jobSplits {
+		if existing.JobID == split.JobID && existing.ID == split.ID {
+			existing.TotalResults = split.TotalResults
+			existing.SplitBy = split.SplitBy
+			existing.Pages = split.Pages
+			existing.Truncated = split.Truncated
+			storage.jobSplits[i] = existing
+		}
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) GetJobSplits(jobID string) ([]models.JobSplit, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	var splits []models.JobSplit
+	for _, split := range storage.jobSplits {
+		if split.JobID == jobID {
+			splits = append(splits, split)
+		}
+	}
+	return splits, nil
+}
+
+func (storage *MemoryStorage) CreateVisitedTask(task models.Task) (bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	key := task.JobID + "|" + task.ScopusID
+	if storage.visited[key] {
+		return false, nil
+	}
+	storage.visited[key] = true
+	storage.createTask(task)
+	return true, nil
+}
+
+func (storage *MemoryStorage) CreateTask(task models.Task) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.createTask(task)
+	return nil
+}
+
+func (storage *MemoryStorage) createTask(task models.Task) {
+	if storage.taskKeys[task.Key] {
+		return
+	}
+	storage.taskKeys[task.Key] = true
+	task.ID = int64(len(storage.tasks) + 1)
+	task.State = models.TaskPending
+	task.Attempts = 0
+	storage.tasks = append(storage.tasks, memoryTask{Task: task})
+}
+
+func (storage *MemoryStorage) LeaseTask(owner string, lease time.Duration) (models.Task, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	now := time.Now()
+	for i := range storage.tasks {
+		task := &storage.tasks[i]
+		if task.State == models.TaskPending || (task.State == models.TaskLeased && task.LeaseUntil < now.Unix()) {
+			task.State = models.TaskLeased
+			task.LeaseOwner = owner
+			task.LeaseUntil = now.Add(lease).Unix()
+			task.Attempts++
+			return task.Task, nil
+		}
+	}
+	return models.Task{}, ErrNotFound
+}
+
+func (storage *MemoryStorage) setTaskState(id int64, state string, reason string) {
+	for i := range storage.tasks {
+		if storage.tasks[i].ID == id {
+			storage.tasks[i].State = state
+			storage.tasks[i].LeaseOwner = ""
+			if reason != "" {
+				storage.tasks[i].LastError = reason
+			}
+			return
+		}
+	}
+}
+
+func (storage *MemoryStorage) CompleteTask(id int64) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.setTaskState(id, models.TaskDone, "")
+	return nil
+}
+
+func (storage *MemoryStorage) FailTask(id int64, reason string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.setTaskState(id, models.TaskFailed, reason)
+	return nil
+}
+
+func (storage *MemoryStorage) ReleaseTasks() error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	for i := range storage.tasks {
+		if storage.tasks[i].State == models.TaskLeased {
+			storage.tasks[i].State = models.TaskPending
+			storage.tasks[i].LeaseOwner = ""
+		}
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) CountActiveTasks(jobID string) (int, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	return storage.countActiveTasks(jobID), nil
+}
+
+func (storage *MemoryStorage) countActiveTasks(jobID string) int {
+	count := 0
+	for _, task := range storage.tasks {
+		if task.JobID == jobID && (task.State == models.TaskPending || task.State == models.TaskLeased) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,489 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const createSchemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER,
+	name TEXT,
+	applied_at BIGINT,
+	PRIMARY KEY (version)
+)`
+
+// MigrationStep changes the schema within the transaction of its migration.
+// MySQL commits schema changes implicitly, so there a failed step is not
+// rolled back.
+type MigrationStep func(storage *MySqlStorage, tx *sql.Tx) error
+
+// Migration moves the schema from the previous version to Version and back
+type Migration struct {
+	Version int
+	Name    string
+	Up      MigrationStep
+	Down    MigrationStep
+}
+
+// Migrations are applied in order. The statements of a released migration
+// are never changed, including the create*Table constants it uses: a table
+// of another shape takes a new migration. Tables made before the migrations
+// are kept as they are, the migrations which have to tell their shape
+// check the columns.
+var Migrations = []Migration{
+	{1, "initial schema", createInitialSchema, dropInitialSchema},
+	{2, "jobs", execStatements(createJobsTable), execStatements("DROP TABLE jobs")},
+	{3, "crawl tasks", createCrawlTasks, execStatements("DROP TABLE crawl_tasks")},
+	{4, "finished request hashes", hashFinishedRequests, unhashFinishedRequests},
+	{5, "failed requests", execStatements(createFailedRequestsTable), execStatements("DROP TABLE failed_requests")},
+	{6, "job splits", execStatements(createJobSplitsTable), execStatements("DROP TABLE job_splits")},
+	{7, "visited articles", execStatements(createVisitedArticlesTable), execStatements("DROP TABLE visited_articles")},
+	{8, "author profiles", execStatements(authorProfileTables...), execStatements("DROP TABLE author_affiliation",
+		"DROP TABLE author_area", "DROP TABLE author_name_variant", "DROP TABLE author_profiles")},
+	{9, "link table keys", addLinkKeys, dropLinkKeys},
+	{10, "author affiliations", addAuthorAffiliations, execStatements("ALTER TABLE authors DROP COLUMN affiliation_id")},
+	{11, "article affiliations and author order", addArticleAffiliations, execStatements(
+		"DROP TABLE article_affiliation", "ALTER TABLE article_author DROP COLUMN author_position")},
+	{12, "author profile keys", addAuthorLinkKeys, dropAuthorLinkKeys},
+	{13, "affiliation retrievals", addAffiliationRetrievals,
+		execStatements("ALTER TABLE affiliations DROP COLUMN retrieved_at")},
+}
+
+// initialSchema is the schema of the crawler before the migrations
+var initialSchema = []string{
+	`CREATE TABLE IF NOT EXISTS affiliations (
+	scopus_id VARCHAR(20),
+	title TEXT,
+	country TEXT,
+	city TEXT,
+	state TEXT,
+	postal_code TEXT,
+	address TEXT,
+    PRIMARY KEY (scopus_id)
+)`,
+	`CREATE TABLE IF NOT EXISTS authors (
+	scopus_id VARCHAR(20),
+	initials TEXT,
+	indexed_name TEXT,
+	surname TEXT,
+	name TEXT,
+	PRIMARY KEY (scopus_id)
+)`,
+	`CREATE TABLE IF NOT EXISTS keywords (
+	id VARCHAR(20),
+	keyword TEXT,
+	PRIMARY KEY (id)
+)`,
+	`CREATE TABLE IF NOT EXISTS subject_areas (
+	scopus_id VARCHAR(20),
+	title TEXT,
+	code TEXT,
+	description TEXT,
+	PRIMARY KEY (scopus_id)
+)`,
+	`CREATE TABLE IF NOT EXISTS articles (
+	scopus_id VARCHAR(20),
+	title TEXT,
+	abstracts TEXT,
+	publication_date TEXT,
+	citations_count INTEGER,
+	publication_type TEXT,
+	publication_title TEXT,
+	doi TEXT,
+	PRIMARY KEY (scopus_id)
+)`,
+	`CREATE TABLE IF NOT EXISTS article_area(
+	area_id VARCHAR(20),
+	article_id VARCHAR(20)
+)`,
+	`CREATE TABLE IF NOT EXISTS article_article(
+	from_id VARCHAR(20),
+	to_id VARCHAR(20)
+)`,
+	`CREATE TABLE IF NOT EXISTS article_author(
+	author_id VARCHAR(20),
+	article_id VARCHAR(20),
+	author_affiliations TEXT
+)`,
+	`CREATE TABLE IF NOT EXISTS article_keyword(
+	keyword_id VARCHAR(20),
+	article_id VARCHAR(20)
+)`,
+	`CREATE TABLE IF NOT EXISTS finished_requests(
+	request VARCHAR(256) PRIMARY KEY,
+	response TEXT
+)`,
+}
+
+// initialSchemaPostgres is initialSchema with the column types the Postgres
+// dialect started with
+var initialSchemaPostgres = []string{
+	initialSchema[0],
+	initialSchema[1],
+	initialSchema[2],
+	initialSchema[3],
+	`CREATE TABLE IF NOT EXISTS articles (
+	scopus_id VARCHAR(20),
+	title TEXT,
+	abstracts TEXT,
+	publication_date DATE,
+	citations_count INTEGER,
+	publication_type TEXT,
+	publication_title TEXT,
+	doi TEXT,
+	PRIMARY KEY (scopus_id)
+)`,
+	initialSchema[5],
+	initialSchema[6],
+	`CREATE TABLE IF NOT EXISTS article_author(
+	author_id VARCHAR(20),
+	article_id VARCHAR(20),
+	author_affiliations TEXT[]
+)`,
+	initialSchema[8],
+	initialSchema[9],
+}
+
+// LatestSchemaVersion is the version Init migrates the storage to
+func LatestSchemaVersion() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// SchemaVersion returns the version of the schema, 0 for an empty database
+func (storage *MySqlStorage) SchemaVersion() (int, error) {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return 0, err
+	}
+	_, err = db.Exec(createSchemaVersionTable)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Query(`SELECT COALESCE(MAX(version), 0) FROM schema_version`)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	return checkCount(res)
+}
+
+// Migrate applies the up or down migrations to get the schema of the version
+func (storage *MySqlStorage) Migrate(version int) error {
+	if version < 0 || version > LatestSchemaVersion() {
+		return errors.New("unknown schema version " + strconv.Itoa(version))
+	}
+	current, err := storage.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	for ; current < version; current++ {
+		err = storage.migrate(Migrations[current], true)
+		if err != nil {
+			return err
+		}
+	}
+	for ; current > version; current-- {
+		err = storage.migrate(Migrations[current-1], false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (storage *MySqlStorage) migrate(migration Migration, up bool) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if up {
+		log.Println("applying migration " + strconv.Itoa(migration.Version) + " " + migration.Name)
+		err = migration.Up(storage, tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(storage.rebind(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`),
+			migration.Version, migration.Name, time.Now().Unix())
+	} else {
+		log.Println("reverting migration " + strconv.Itoa(migration.Version) + " " + migration.Name)
+		err = migration.Down(storage, tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(storage.rebind(`DELETE FROM schema_version WHERE version = ?`), migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func execStatements(statements ...string) MigrationStep {
+	return func(storage *MySqlStorage, tx *sql.Tx) error {
+		for _, statement := range statements {
+			_, err := tx.Exec(statement)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// createInitialSchema creates the tables which do not exist. The tables of
+// the databases made before the migrations are left for the later ones.
+func createInitialSchema(storage *MySqlStorage, tx *sql.Tx) error {
+	if storage.DBType == POSTGRES {
+		return execStatements(initialSchemaPostgres...)(storage, tx)
+	}
+	return execStatements(initialSchema...)(storage, tx)
+}
+
+// dropInitialSchema drops the tables, the link tables go first
+var dropInitialSchema = execStatements(
+	"DROP TABLE IF EXISTS article_author",
+	"DROP TABLE IF EXISTS article_article",
+	"DROP TABLE IF EXISTS article_area",
+	"DROP TABLE IF EXISTS article_keyword",
+	"DROP TABLE IF EXISTS finished_requests",
+	"DROP TABLE IF EXISTS articles",
+	"DROP TABLE IF EXISTS subject_areas",
+	"DROP TABLE IF EXISTS keywords",
+	"DROP TABLE IF EXISTS authors",
+	"DROP TABLE IF EXISTS affiliations",
+)
+
+// authorProfileTables are the tables of the author profiles before the keys
+// of their links
+var authorProfileTables = []string{
+	createAuthorProfilesTable,
+	`CREATE TABLE IF NOT EXISTS author_name_variant(
+	author_id VARCHAR(20),
+	name TEXT
+)`,
+	`CREATE TABLE IF NOT EXISTS author_area(
+	author_id VARCHAR(20),
+	area_id VARCHAR(20)
+)`,
+	`CREATE TABLE IF NOT EXISTS author_affiliation(
+	author_id VARCHAR(20),
+	affiliation_id VARCHAR(20)
+)`,
+}
+
+func createCrawlTasks(storage *MySqlStorage, tx *sql.Tx) error {
+	return execStatements(storage.crawlTasksSchema()...)(storage, tx)
+}
+
+// addLinkKeys rebuilds the link tables of the databases made before they had
+// primary keys, dropping the duplicate links
+func addLinkKeys(storage *MySqlStorage, tx *sql.Tx) error {
+	return storage.rebuildLinkTables(tx, linkTables, storage.linkSchema())
+}
+
+func dropLinkKeys(storage *MySqlStorage, tx *sql.Tx) error {
+	affiliationsType := "TEXT"
+	if storage.DBType == POSTGRES {
+		affiliationsType = "TEXT[]"
+	}
+	return storage.rebuildLinkTables(tx, linkTables, []string{
+		`CREATE TABLE article_author(author_id VARCHAR(20), article_id VARCHAR(20), author_affiliations ` +
+			affiliationsType + `)`,
+		`CREATE TABLE article_article(from_id VARCHAR(20), to_id VARCHAR(20))`,
+		`CREATE TABLE article_area(area_id VARCHAR(20), article_id VARCHAR(20))`,
+		`CREATE TABLE article_keyword(keyword_id VARCHAR(20), article_id VARCHAR(20))`,
+	})
+}
+
+// addAuthorAffiliations adds the column of the current affiliations of the
+// author, stored the same way as in article_author
+func addAuthorAffiliations(storage *MySqlStorage, tx *sql.Tx) error {
+	columnType := "TEXT"
+	if storage.DBType == POSTGRES {
+		columnType = "TEXT[]"
+	}
+	_, err := tx.Exec("ALTER TABLE authors ADD COLUMN affiliation_id " + columnType)
+	return err
+}
+
+// addArticleAffiliations links the articles with their affiliations and keeps
+// the order of the authors. The affiliations of the stored articles are taken
+// from their authors.
+func addArticleAffiliations(storage *MySqlStorage, tx *sql.Tx) error {
+	statements := []string{createArticleAffiliationsTable,
+		"ALTER TABLE article_author ADD COLUMN author_position INTEGER"}
+	if storage.DBType != MYSQL {
+		statements = append(statements, createArticleAffiliationsIndex)
+	}
+	err := execStatements(statements...)(storage, tx)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Query(`SELECT article_id, author_affiliations FROM article_author`)
+	if err != nil {
+		return err
+	}
+	links := map[[2]string]bool{}
+	for res.Next() {
+		var articleID string
+		var affiliationIDs []string
+		err = res.Scan(&articleID, storage.affiliationsDest(&affiliationIDs))
+		if err != nil {
+			res.Close()
+			return err
+		}
+		for _, affiliationID := range affiliationIDs {
+			links[[2]string{affiliationID, articleID}] = true
+		}
+	}
+	res.Close()
+	query := storage.insertIgnoreSelectQuery("article_affiliation", []string{"affiliation_id", "article_id"},
+		"SELECT scopus_id, ? FROM affiliations WHERE scopus_id = ?")
+	for link := range links {
+		_, err = tx.Exec(query, link[1], link[0])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addAuthorLinkKeys rebuilds the links of the author profiles with primary
+// keys, dropping the duplicates left by concurrent or repeated writes
+func addAuthorLinkKeys(storage *MySqlStorage, tx *sql.Tx) error {
+	return storage.rebuildLinkTables(tx, authorLinkTables, authorLinkSchema)
+}
+
+func dropAuthorLinkKeys(storage *MySqlStorage, tx *sql.Tx) error {
+	return storage.rebuildLinkTables(tx, authorLinkTables, authorProfileTables[1:])
+}
+
+// addAffiliationRetrievals adds the time the affiliation was retrieved at.
+// The affiliations with any of the columns only the retrieval has are taken
+// as retrieved now, the others are retrieved again.
+func addAffiliationRetrievals(storage *MySqlStorage, tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE affiliations ADD COLUMN retrieved_at BIGINT")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(storage.rebind(`UPDATE affiliations SET retrieved_at = ?
+		WHERE COALESCE(address, '') <> '' OR COALESCE(state, '') <> '' OR COALESCE(postal_code, '') <> ''`),
+		time.Now().Unix())
+	return err
+}
+
+// hashFinishedRequests converts the finished_requests table of the first
+// version, keyed by the request, into the one keyed by its hash. The
+// converted responses have no time they were stored at, so they expire with
+// any cache TTL. Databases made before the migrations may have the converted
+// table already.
+func hashFinishedRequests(storage *MySqlStorage, tx *sql.Tx) error {
+	columns, err := storage.tableColumns(tx, "finished_requests")
+	if err != nil {
+		return err
+	}
+	if columns["request_hash"] {
+		return nil
+	}
+	table := createFinishedRequestsTable
+	if storage.DBType == POSTGRES {
+		table = createFinishedRequestsTablePostgres
+	}
+	return storage.convertFinishedRequests(tx, table, func(request string, response string) []interface{} {
+		return []interface{}{hashRequest(request), request, response, 0}
+	}, "request_hash", "request", "response", "created_at")
+}
+
+// unhashFinishedRequests drops the responses to the requests too long for the
+// key of the first version
+func unhashFinishedRequests(storage *MySqlStorage, tx *sql.Tx) error {
+	return storage.convertFinishedRequests(tx, `CREATE TABLE finished_requests(
+	request VARCHAR(256) PRIMARY KEY,
+	response TEXT
+)`, func(request string, response string) []interface{} {
+		if len(request) > 256 {
+			return nil
+		}
+		return []interface{}{request, response}
+	}, "request", "response")
+}
+
+// convertFinishedRequests recreates the finished_requests table and copies
+// the responses into it with the columns made by row, a nil row is skipped
+func (storage *MySqlStorage) convertFinishedRequests(tx *sql.Tx, table string,
+	row func(request string, response string) []interface{}, columns ...string) error {
+	_, err := tx.Exec("ALTER TABLE finished_requests RENAME TO finished_requests_old")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(table)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Query("SELECT request, response FROM finished_requests_old")
+	if err != nil {
+		return err
+	}
+	var rows [][]interface{}
+	for res.Next() {
+		var request, response string
+		err = res.Scan(&request, &response)
+		if err != nil {
+			res.Close()
+			return err
+		}
+		if values := row(request, response); values != nil {
+			rows = append(rows, values)
+		}
+	}
+	err = res.Err()
+	res.Close()
+	if err != nil {
+		return err
+	}
+	for _, values := range rows {
+		_, err = tx.Exec(storage.insertIgnoreQuery("finished_requests", columns...), values...)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("DROP TABLE finished_requests_old")
+	return err
+}
+
+// tableColumns returns the names of the columns of the table
+func (storage *MySqlStorage) tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	query := `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ?`
+	switch storage.DBType {
+	case SQLITE:
+		query = `SELECT name FROM pragma_table_info(?)`
+	case POSTGRES:
+		query = `SELECT column_name FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	res, err := tx.Query(storage.rebind(query), table)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	columns := map[string]bool{}
+	for res.Next() {
+		var column string
+		err = res.Scan(&column)
+		if err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(column)] = true
+	}
+	return columns, res.Err()
+}
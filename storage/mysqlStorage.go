@@ -1,105 +1,74 @@
 package storage
 
 import (
+	"crypto/sha1"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
-	"../logger"
 	"../models"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
 	MYSQL = iota
 	SQLITE
 	POSTGRES
+	MEMORY
 )
 
 type DatabaseType uint8
 
+// ParseDatabaseType converts the database name used in the configuration
+func ParseDatabaseType(name string) (DatabaseType, error) {
+	switch strings.ToLower(name) {
+	case "", "mysql":
+		return MYSQL, nil
+	case "sqlite", "sqlite3":
+		return SQLITE, nil
+	case "postgres", "postgresql":
+		return POSTGRES, nil
+	case "memory":
+		return MEMORY, nil
+	default:
+		return MYSQL, errors.New("unknown database type " + name)
+	}
+}
+
 type MySqlStorage struct {
 	DBType      DatabaseType
 	Address     string
 	User        string
 	Password    string
 	DbName      string
+	SSLMode     string
 	Initialized bool
 	DB          *sql.DB
 }
 
-const createAuthorsTable = `CREATE TABLE IF NOT EXISTS authors (
-	scopus_id VARCHAR(20),
-	initials TEXT,
-	indexed_name TEXT,
-	surname TEXT,
-	name TEXT,
-	PRIMARY KEY (scopus_id)
-)`
-
-const createAffiliationsTable = `CREATE TABLE IF NOT EXISTS affiliations (
-	scopus_id VARCHAR(20),
-	title TEXT,
-	country TEXT,
-	city TEXT,
-	state TEXT,
-	postal_code TEXT,
-	address TEXT,
-    PRIMARY KEY (scopus_id)
-)`
-
-const createArticlesTable = `CREATE TABLE IF NOT EXISTS articles (
-	scopus_id VARCHAR(20),
-	title TEXT,
-	abstracts TEXT,
-	publication_date TEXT,
-	citations_count INTEGER,
-	publication_type TEXT,
-	publication_title TEXT,
-	doi TEXT,
-	PRIMARY KEY (scopus_id)
-)`
-
-const createSubjectAreasTable = `CREATE TABLE IF NOT EXISTS subject_areas (
-	scopus_id VARCHAR(20),
-	title TEXT,
-	code TEXT,
-	description TEXT,
-	PRIMARY KEY (scopus_id)
-)`
-
-const createKeywordsTable = `CREATE TABLE IF NOT EXISTS keywords (
-	id VARCHAR(20),
-	keyword TEXT,
-	PRIMARY KEY (id)
-)`
-
-const createArticleAuthorsTable = `CREATE TABLE IF NOT EXISTS article_author(
-	author_id VARCHAR(20),
-	article_id VARCHAR(20),
-	author_affiliations TEXT
-)`
-
-const createArticleArticlesTable = `CREATE TABLE IF NOT EXISTS article_article(
-	from_id VARCHAR(20),
-	to_id VARCHAR(20)
-)`
-
-const createArticleAreasTable = `CREATE TABLE IF NOT EXISTS article_area(
-	area_id VARCHAR(20),
-	article_id VARCHAR(20)
-)`
-
-const createArticleKeywordsTable = `CREATE TABLE IF NOT EXISTS article_keyword(
-	keyword_id VARCHAR(20),
-	article_id VARCHAR(20)
+const createFinishedRequestsTable = `CREATE TABLE IF NOT EXISTS finished_requests(
+	request_hash VARCHAR(40),
+	request TEXT,
+	response MEDIUMTEXT,
+	created_at BIGINT,
+	PRIMARY KEY (request_hash)
 )`
 
-const createFinishedRequestsTable = `CREATE TABLE IF NOT EXISTS finished_requests(
-	request VARCHAR(256) PRIMARY KEY,
-	response TEXT
+const createFailedRequestsTable = `CREATE TABLE IF NOT EXISTS failed_requests(
+	request_hash VARCHAR(40),
+	request TEXT,
+	kind VARCHAR(16),
+	status INTEGER,
+	error TEXT,
+	attempts INTEGER,
+	created_at BIGINT,
+	PRIMARY KEY (request_hash)
 )`
 
 func getDb(storage *MySqlStorage) (*sql.DB, error) {
@@ -113,14 +82,18 @@ func getDb(storage *MySqlStorage) (*sql.DB, error) {
 		}
 		return db, nil
 	case SQLITE:
-		db, err := sql.Open("sqlite3", storage.DbName)
+		log.Println("new SQLite connection")
+		path := fmt.Sprintf("file:%s?_busy_timeout=10000&_journal_mode=WAL&_foreign_keys=1", storage.DbName)
+		db, err := sql.Open("sqlite3", path)
 		if err != nil {
 			return nil, err
 		}
+		// SQLite allows a single writer, so the workers share one connection
+		db.SetMaxOpenConns(1)
 		return db, nil
 	case POSTGRES:
 		log.Println("new Postgres connection")
-		db, err := sql.Open("postgres", "user=gk91 dbname=test sslmode =disable")
+		db, err := sql.Open("postgres", postgresDSN(storage))
 		if err != nil {
 			return nil, err
 		}
@@ -130,54 +103,28 @@ func getDb(storage *MySqlStorage) (*sql.DB, error) {
 	}
 }
 
-// Init creates new storage or initializes the existing one
+// Init creates new storage or initializes the existing one, migrating its
+// schema to the latest version
 func (storage *MySqlStorage) Init() error {
-	db, err := getDb(storage)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(createAffiliationsTable)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(createAuthorsTable)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(createKeywordsTable)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(createSubjectAreasTable)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(createArticlesTable)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(createArticleAreasTable)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(createArticleArticlesTable)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(createArticleAuthorsTable)
+	err := storage.Open()
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(createArticleKeywordsTable)
+	err = storage.Migrate(LatestSchemaVersion())
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(createFinishedRequestsTable)
+	storage.Initialized = true
+	return nil
+}
+
+// Open connects to the database without changing its schema
+func (storage *MySqlStorage) Open() error {
+	db, err := getDb(storage)
 	if err != nil {
 		return err
 	}
 	storage.DB = db
-	storage.Initialized = true
 	return nil
 }
 
@@ -185,14 +132,17 @@ func (storage *MySqlStorage) getDBConnection() (*sql.DB, error) {
 	return storage.DB, nil
 }
 
+// CreateAffiliation stores the affiliation retrieved from the Affiliation
+// Retrieval API, the ones embedded in the articles are written with them
 func (storage *MySqlStorage) CreateAffiliation(affiliation models.Affiliation) error {
 	db, err := storage.getDBConnection()
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare("REPLACE INTO affiliations VALUES (?, ?, ?, ?, ?, ?, ?)")
+	req, _ := db.Prepare(storage.upsertQuery("affiliations", []string{"scopus_id"},
+		"title", "country", "city", "state", "postal_code", "address", "retrieved_at"))
 	_, err = req.Exec(affiliation.ScopusID, affiliation.Title, affiliation.Country, affiliation.City,
-		affiliation.State, affiliation.PostalCode, affiliation.Address)
+		affiliation.State, affiliation.PostalCode, affiliation.Address, time.Now().Unix())
 	if err != nil {
 		return err
 	}
@@ -204,9 +154,9 @@ func (storage *MySqlStorage) UpdateAffiliation(affiliation models.Affiliation) e
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`UPDATE affiliations 
+	req, _ := db.Prepare(storage.rebind(`UPDATE affiliations 
 		SET title = ?, country = ?, city = ?, state = ?, postal_code = ?, address = ?
-		WHERE scopus_id = ?`)
+		WHERE scopus_id = ?`))
 	_, err = req.Exec(affiliation.Title, affiliation.Country, affiliation.City, affiliation.State,
 		affiliation.PostalCode, affiliation.Address, affiliation.ScopusID)
 	if err != nil {
@@ -221,7 +171,8 @@ func (storage *MySqlStorage) GetAffiliation(scopusID string) (models.Affiliation
 	if err != nil {
 		return affiliation, err
 	}
-	req, _ := db.Prepare(`SELECT DISTINCT * FROM affiliations WHERE scopus_id = ?`)
+	req, _ := db.Prepare(storage.rebind(`SELECT scopus_id, title, country, city, state, postal_code, address FROM affiliations
+		WHERE scopus_id = ?`))
 	res, err := req.Query(scopusID)
 	defer res.Close()
 	if err != nil {
@@ -238,21 +189,21 @@ func (storage *MySqlStorage) GetAffiliation(scopusID string) (models.Affiliation
 	return affiliation, errors.New("data was not found in the storage")
 }
 
-func (storage *MySqlStorage) SearchAffiliations(fields map[string]string) ([]models.Affiliation, error) {
-	var affiliations []models.Affiliation
+func (storage *MySqlStorage) SearchAffiliations(filter Filter) ([]models.Affiliation, error) {
+	affiliations := []models.Affiliation{}
 	db, err := storage.getDBConnection()
 	if err != nil {
 		return affiliations, err
 	}
-	query := "SELECT DISTINCT * FROM affiliations WHERE "
-	for key, value := range fields {
-		query = query + key + "=" + value + " AND "
+	query, args, err := storage.searchQuery("affiliations", "scopus_id, title, country, city, state, postal_code, address", filter)
+	if err != nil {
+		return affiliations, err
 	}
-	query = query[:(len(query) - 4)]
-	res, err := db.Query(query)
+	res, err := db.Query(query, args...)
 	if err != nil {
 		return affiliations, err
 	}
+	defer res.Close()
 	for res.Next() {
 		var affiliation models.Affiliation
 		err = res.Scan(&affiliation.ScopusID, &affiliation.Title, &affiliation.Country,
@@ -270,89 +221,18 @@ func (storage *MySqlStorage) DeleteAffiliation(scopusID string) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`DELETE FROM affiliations WHERE scopus_id = ?`)
+	req, _ := db.Prepare(storage.rebind(`DELETE FROM affiliations WHERE scopus_id = ?`))
 	_, err = req.Exec(scopusID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// CreateArticle writes the article with its linked records in a single
+// transaction
 func (storage *MySqlStorage) CreateArticle(article models.Article) error {
-	db, err := storage.getDBConnection()
-	if err != nil {
-		return err
-	}
-	req, _ := db.Prepare("REPLACE INTO articles VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
-	defer req.Close()
-	_, err = req.Exec(article.ScopusID, article.Title, article.Abstracts, article.PublicationDate,
-		article.CitationsCount, article.PublicationType, article.PublicationTitle, article.Doi)
-	if err != nil {
-		return err
-	}
-	for _, affiliation := range article.Affiliations {
-		err = storage.CreateAffiliation(affiliation)
-		if err != nil {
-			logger.Error.Println("Unable to add affiliation " + affiliation.ScopusID + " to storage")
-			logger.Error.Println(err)
-		}
-	}
-	for _, area := range article.SubjectAreas {
-		err = storage.CreateSubjectArea(area)
-		if err != nil {
-			logger.Error.Println("Unable to add subject area " + area.ScopusID + " to storage")
-			logger.Error.Println(err)
-		} else {
-			req, _ := db.Prepare("INSERT INTO article_area VALUES(?, ?)")
-			_, err = req.Exec(area.ScopusID, article.ScopusID)
-			req.Close()
-			if err != nil {
-				logger.Error.Println("Unable to connect article " + article.ScopusID + " with area " + area.ScopusID)
-				logger.Error.Println(err)
-			}
-		}
-	}
-	for _, author := range article.Authors {
-		err = storage.CreateAuthor(author)
-		if err != nil {
-			logger.Error.Println("Unable to add author " + author.ScopusID + " to storage")
-			logger.Error.Println(err)
-		} else {
-			req, _ := db.Prepare("INSERT INTO article_author VALUES(?, ?, ?)")
-			var afids string = ""
-			afids = strings.Join(author.AffiliationID[:], ",")
-			_, err = req.Exec(author.ScopusID, article.ScopusID, afids)
-			req.Close()
-			if err != nil {
-				logger.Error.Println("Unable to connect article " + article.ScopusID + " with author " + author.ScopusID)
-				logger.Error.Println(err)
-			}
-		}
-	}
-	for _, keyword := range article.Keywords {
-		err = storage.CreateKeyword(keyword)
-		if err != nil {
-			logger.Error.Println("Unable to add keyword " + keyword.ID + " to storage")
-			logger.Error.Println(err)
-		} else {
-			req, _ := db.Prepare("INSERT INTO article_keyword VALUES(?, ?)")
-			_, err = req.Exec(keyword.ID, article.ScopusID)
-			req.Close()
-			if err != nil {
-				logger.Error.Println("Unable to connect article " + article.ScopusID + " with keyword " + keyword.ID)
-				logger.Error.Println(err)
-			}
-		}
-	}
-	for _, reference := range article.References {
-		req, _ := db.Prepare("INSERT INTO article_article VALUES(?, ?)")
-		_, err = req.Exec(article.ScopusID, reference.ScopusID)
-		req.Close()
-		if err != nil {
-			logger.Error.Println("Unable to connect article " + article.ScopusID + " with reference " + reference.ScopusID)
-			logger.Error.Println(err)
-		}
-	}
-	return nil
+	return storage.CreateArticles([]models.Article{article})
 }
 
 func (storage *MySqlStorage) UpdateArticle(article models.Article) error {
@@ -360,12 +240,12 @@ func (storage *MySqlStorage) UpdateArticle(article models.Article) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`UPDATE articles 
+	req, _ := db.Prepare(storage.rebind(`UPDATE articles 
 		SET title = ?, abstracts = ?, publication_date = ?, citations_count = ?, publication_type = ?, 
-		publication_title = ?
-		WHERE scopus_id = ?`)
-	_, err = req.Exec(article.Title, article.Abstracts, article.PublicationDate, article.CitationsCount,
-		article.PublicationType, article.PublicationTitle)
+		publication_title = ?, doi = ?
+		WHERE scopus_id = ?`))
+	_, err = req.Exec(article.Title, article.Abstracts, storage.dateValue(article.PublicationDate), article.CitationsCount,
+		article.PublicationType, article.PublicationTitle, article.Doi, article.ScopusID)
 	req.Close()
 	if err != nil {
 		return err
@@ -373,51 +253,26 @@ func (storage *MySqlStorage) UpdateArticle(article models.Article) error {
 	return nil
 }
 
-func (storage *MySqlStorage) GetArticle(scopusID string) (models.Article, error) {
-	var article models.Article
+func (storage *MySqlStorage) SearchArticles(filter Filter) ([]models.Article, error) {
+	articles := []models.Article{}
 	db, err := storage.getDBConnection()
 	if err != nil {
-		return article, err
-	}
-	req, _ := db.Prepare(`SELECT DISTINCT * FROM articles WHERE scopus_id = ?`)
-	res, err := req.Query(scopusID)
-	defer res.Close()
-	if err != nil {
-		return article, err
-	}
-	for res.Next() {
-		err = res.Scan(&article.ScopusID, &article.Title, &article.Abstracts,
-			&article.PublicationDate, &article.CitationsCount, &article.PublicationType,
-			&article.PublicationTitle)
-		if err != nil {
-			return article, err
-		}
-		return article, nil
+		return articles, err
 	}
-	return article, errors.New("data was not found in the storage")
-}
-
-func (storage *MySqlStorage) SearchArticles(fields map[string]string) ([]models.Article, error) {
-	var articles []models.Article
-	db, err := storage.getDBConnection()
+	query, args, err := storage.searchQuery("articles", storage.articleColumns(), filter)
 	if err != nil {
 		return articles, err
 	}
-	query := "SELECT DISTINCT * FROM articles WHERE "
-	for key, value := range fields {
-		query += key + "=" + value + " AND "
-	}
-	query = query[:(len(query) - 4)]
-	res, err := db.Query(query)
-	defer res.Close()
+	res, err := db.Query(query, args...)
 	if err != nil {
 		return articles, err
 	}
+	defer res.Close()
 	for res.Next() {
 		var article models.Article
 		err = res.Scan(&article.ScopusID, &article.Title, &article.Abstracts,
 			&article.PublicationDate, &article.CitationsCount, &article.PublicationType,
-			&article.PublicationTitle)
+			&article.PublicationTitle, &article.Doi)
 		if err != nil {
 			return articles, err
 		}
@@ -431,7 +286,7 @@ func (storage *MySqlStorage) DeleteArticle(scopusID string) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`DELETE FROM articles WHERE scopus_id = ?`)
+	req, _ := db.Prepare(storage.rebind(`DELETE FROM articles WHERE scopus_id = ?`))
 	_, err = req.Exec(scopusID)
 	req.Close()
 	if err != nil {
@@ -445,9 +300,10 @@ func (storage *MySqlStorage) CreateAuthor(author models.Author) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare("REPLACE INTO authors VALUES (?, ?, ?, ?, ?)")
+	req, _ := db.Prepare(storage.upsertQuery("authors", []string{"scopus_id"}, "initials", "indexed_name", "surname",
+		"name", "affiliation_id"))
 	_, err = req.Exec(author.ScopusID, author.Initials,
-		author.IndexedName, author.Surname, author.Name)
+		author.IndexedName, author.Surname, author.Name, storage.affiliationsValue(author.AffiliationID))
 	req.Close()
 	if err != nil {
 		return err
@@ -460,10 +316,10 @@ func (storage *MySqlStorage) UpdateAuthor(author models.Author) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`UPDATE authors 
+	req, _ := db.Prepare(storage.rebind(`UPDATE authors 
 		SET affiliation_id = ?, initials = ?, indexed_name = ?, surname = ?, name = ?
-		WHERE scopus_id = ?`)
-	_, err = req.Exec(author.AffiliationID, author.Initials,
+		WHERE scopus_id = ?`))
+	_, err = req.Exec(storage.affiliationsValue(author.AffiliationID), author.Initials,
 		author.IndexedName, author.Surname, author.Name, author.ScopusID)
 	req.Close()
 	if err != nil {
@@ -478,42 +334,46 @@ func (storage *MySqlStorage) GetAuthor(scopusID string) (models.Author, error) {
 	if err != nil {
 		return author, err
 	}
-	req, _ := db.Prepare(`SELECT DISTINCT * FROM authors WHERE scopus_id = ?`)
-	res, err := req.Query(scopusID)
-	defer res.Close()
-	req.Close()
+	res, err := db.Query(storage.rebind(`SELECT DISTINCT `+authorColumns+` FROM authors WHERE scopus_id = ?`), scopusID)
 	if err != nil {
 		return author, err
 	}
-	for res.Next() {
-		err = res.Scan(&author.ScopusID, &author.AffiliationID, &author.Initials, &author.IndexedName, &author.Surname, &author.Name)
-		if err != nil {
-			return author, err
-		}
-		return author, nil
+	found := res.Next()
+	if found {
+		err = res.Scan(&author.ScopusID, storage.affiliationsDest(&author.AffiliationID), &author.Initials,
+			&author.IndexedName, &author.Surname, &author.Name)
+	}
+	// the connection is released before the profile is loaded
+	res.Close()
+	if err != nil {
+		return author, err
+	}
+	if !found {
+		return author, errors.New("data was not found in the storage")
 	}
-	return author, errors.New("data was not found in the storage")
+	err = storage.loadAuthorProfile(db, &author)
+	return author, err
 }
 
-func (storage *MySqlStorage) SearchAuthors(fields map[string]string) ([]models.Author, error) {
-	var authors []models.Author
+func (storage *MySqlStorage) SearchAuthors(filter Filter) ([]models.Author, error) {
+	authors := []models.Author{}
 	db, err := storage.getDBConnection()
 	if err != nil {
 		return authors, err
 	}
-	query := "SELECT DISTINCT * FROM authors WHERE "
-	for key, value := range fields {
-		query = query + key + "=" + value + " AND "
+	query, args, err := storage.searchQuery("authors", authorColumns, filter)
+	if err != nil {
+		return authors, err
 	}
-	query = query[:(len(query) - 4)]
-	res, err := db.Query(query)
+	res, err := db.Query(query, args...)
 	if err != nil {
 		return authors, err
 	}
 	defer res.Close()
 	for res.Next() {
 		var author models.Author
-		err = res.Scan(&author.ScopusID, &author.AffiliationID, &author.Initials, &author.IndexedName, &author.Surname, &author.Name)
+		err = res.Scan(&author.ScopusID, storage.affiliationsDest(&author.AffiliationID), &author.Initials,
+			&author.IndexedName, &author.Surname, &author.Name)
 		if err != nil {
 			return authors, err
 		}
@@ -527,7 +387,7 @@ func (storage *MySqlStorage) DeleteAuthor(scopusID string) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`DELETE FROM authors WHERE scopus_id = ?`)
+	req, _ := db.Prepare(storage.rebind(`DELETE FROM authors WHERE scopus_id = ?`))
 	_, err = req.Exec(scopusID)
 	if err != nil {
 		return err
@@ -540,7 +400,7 @@ func (storage *MySqlStorage) CreateKeyword(keyword models.Keyword) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare("REPLACE INTO keywords VALUES (?, ?)")
+	req, _ := db.Prepare(storage.upsertQuery("keywords", []string{"id"}, "keyword"))
 	_, err = req.Exec(keyword.ID, keyword.Value)
 	if err != nil {
 		return err
@@ -548,16 +408,23 @@ func (storage *MySqlStorage) CreateKeyword(keyword models.Keyword) error {
 	return nil
 }
 
+// CheckAffiliation reports whether the affiliation was retrieved. The ones
+// embedded in the articles lack the address, so they are not counted.
 func (storage *MySqlStorage) CheckAffiliation(afid string) (bool, error) {
 	db, err := storage.getDBConnection()
 	if err != nil {
 		return false, err
 	}
-	res, err := db.Query(`SELECT TOP 1 scopus_id FROM affiliations WHERE scopus_id=?`, afid)
+	res, err := db.Query(storage.rebind(`SELECT COUNT(*) FROM affiliations
+		WHERE scopus_id = ? AND retrieved_at IS NOT NULL`), afid)
 	if err != nil {
 		return false, err
 	}
+	defer res.Close()
 	count, err := checkCount(res)
+	if err != nil {
+		return false, err
+	}
 	if count > 0 {
 		return true, nil
 	}
@@ -579,7 +446,7 @@ func (storage *MySqlStorage) UpdateKeyword(keyword models.Keyword) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`UPDATE keywords SET value = ? WHERE id = ?`)
+	req, _ := db.Prepare(storage.rebind(`UPDATE keywords SET keyword = ? WHERE id = ?`))
 	_, err = req.Exec(keyword.Value, keyword.ID)
 	if err != nil {
 		return err
@@ -593,7 +460,7 @@ func (storage *MySqlStorage) GetKeyword(id string) (models.Keyword, error) {
 	if err != nil {
 		return keyword, err
 	}
-	req, _ := db.Prepare(`SELECT DISTINCT * FROM keywords WHERE id = ?`)
+	req, _ := db.Prepare(storage.rebind(`SELECT DISTINCT * FROM keywords WHERE id = ?`))
 	res, err := req.Query(id)
 	defer res.Close()
 	if err != nil {
@@ -609,21 +476,21 @@ func (storage *MySqlStorage) GetKeyword(id string) (models.Keyword, error) {
 	return keyword, errors.New("data was not found in the storage")
 }
 
-func (storage *MySqlStorage) SearchKeywords(fields map[string]string) ([]models.Keyword, error) {
-	var keywords []models.Keyword
+func (storage *MySqlStorage) SearchKeywords(filter Filter) ([]models.Keyword, error) {
+	keywords := []models.Keyword{}
 	db, err := storage.getDBConnection()
 	if err != nil {
 		return keywords, err
 	}
-	query := "SELECT DISTINCT * FROM keywords WHERE "
-	for key, value := range fields {
-		query = query + key + "=" + value + " AND "
+	query, args, err := storage.searchQuery("keywords", "id, keyword", filter)
+	if err != nil {
+		return keywords, err
 	}
-	query = query[:(len(query) - 4)]
-	res, err := db.Query(query)
+	res, err := db.Query(query, args...)
 	if err != nil {
 		return keywords, err
 	}
+	defer res.Close()
 	for res.Next() {
 		var keyword models.Keyword
 		err = res.Scan(&keyword.ID, &keyword.Value)
@@ -640,7 +507,7 @@ func (storage *MySqlStorage) DeleteKeyword(id string) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`DELETE FROM keywords WHERE id = ?`)
+	req, _ := db.Prepare(storage.rebind(`DELETE FROM keywords WHERE id = ?`))
 	_, err = req.Exec(id)
 	if err != nil {
 		return err
@@ -653,7 +520,7 @@ func (storage *MySqlStorage) CreateSubjectArea(subjectArea models.SubjectArea) e
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare("REPLACE INTO subject_areas VALUES (?, ?, ?, ?)")
+	req, _ := db.Prepare(storage.upsertQuery("subject_areas", []string{"scopus_id"}, "title", "code", "description"))
 	_, err = req.Exec(subjectArea.ScopusID, subjectArea.Title, subjectArea.Code, subjectArea.Description)
 	if err != nil {
 		return err
@@ -661,14 +528,14 @@ func (storage *MySqlStorage) CreateSubjectArea(subjectArea models.SubjectArea) e
 	return nil
 }
 
-func (storage MySqlStorage) UpdateSubjectArea(subjectArea models.SubjectArea) error {
+func (storage *MySqlStorage) UpdateSubjectArea(subjectArea models.SubjectArea) error {
 	db, err := storage.getDBConnection()
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`UPDATE subject_areas 
+	req, _ := db.Prepare(storage.rebind(`UPDATE subject_areas 
 		SET title = ?, code = ?, description = ?
-		WHERE scopus_id = ?`)
+		WHERE scopus_id = ?`))
 	_, err = req.Exec(subjectArea.Title, subjectArea.Code, subjectArea.Description, subjectArea.ScopusID)
 	if err != nil {
 		return err
@@ -682,7 +549,7 @@ func (storage *MySqlStorage) GetSubjectArea(scopusID string) (models.SubjectArea
 	if err != nil {
 		return subjectArea, err
 	}
-	req, _ := db.Prepare(`SELECT DISTINCT * FROM subject_areas WHERE scopus_id = ?`)
+	req, _ := db.Prepare(storage.rebind(`SELECT DISTINCT * FROM subject_areas WHERE scopus_id = ?`))
 	res, err := req.Query(scopusID)
 	defer res.Close()
 	if err != nil {
@@ -699,21 +566,21 @@ func (storage *MySqlStorage) GetSubjectArea(scopusID string) (models.SubjectArea
 	return subjectArea, errors.New("data was not found in the storage")
 }
 
-func (storage *MySqlStorage) SearchSubjectAreas(fields map[string]string) ([]models.SubjectArea, error) {
-	var subjectAreas []models.SubjectArea
+func (storage *MySqlStorage) SearchSubjectAreas(filter Filter) ([]models.SubjectArea, error) {
+	subjectAreas := []models.SubjectArea{}
 	db, err := storage.getDBConnection()
 	if err != nil {
 		return subjectAreas, err
 	}
-	query := "SELECT DISTINCT * FROM subjectAreas WHERE "
-	for key, value := range fields {
-		query = query + key + "=" + value + " AND "
+	query, args, err := storage.searchQuery("subject_areas", "scopus_id, title, code, description", filter)
+	if err != nil {
+		return subjectAreas, err
 	}
-	query = query[:(len(query) - 4)]
-	res, err := db.Query(query)
+	res, err := db.Query(query, args...)
 	if err != nil {
 		return subjectAreas, err
 	}
+	defer res.Close()
 	for res.Next() {
 		var subjectArea models.SubjectArea
 		err = res.Scan(&subjectArea.ScopusID, &subjectArea.Title, &subjectArea.Code,
@@ -731,7 +598,7 @@ func (storage *MySqlStorage) DeleteSubjectArea(scopusID string) error {
 	if err != nil {
 		return err
 	}
-	req, _ := db.Prepare(`DELETE FROM subject_areas WHERE scopus_id = ?`)
+	req, _ := db.Prepare(storage.rebind(`DELETE FROM subject_areas WHERE scopus_id = ?`))
 	_, err = req.Exec(scopusID)
 	req.Close()
 	if err != nil {
@@ -739,3 +606,90 @@ func (storage *MySqlStorage) DeleteSubjectArea(scopusID string) error {
 	}
 	return nil
 }
+
+func hashRequest(request string) string {
+	h := sha1.Sum([]byte(request))
+	return hex.EncodeToString(h[:])
+}
+
+func (storage *MySqlStorage) CreateFinishedRequest(request string, response string) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	req, _ := db.Prepare(storage.upsertQuery("finished_requests", []string{"request_hash"}, "request", "response", "created_at"))
+	_, err = req.Exec(hashRequest(request), request, response, time.Now().Unix())
+	req.Close()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetFinishedRequest returns the stored response for the request if it is not
+// older than maxAge. Zero maxAge means stored responses never expire.
+func (storage *MySqlStorage) GetFinishedRequest(request string, maxAge time.Duration) (string, error) {
+	var response string
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return response, err
+	}
+	var since int64
+	if maxAge > 0 {
+		since = time.Now().Add(-maxAge).Unix()
+	}
+	res, err := db.Query(storage.rebind(`SELECT response FROM finished_requests WHERE request_hash = ? AND created_at >= ?`),
+		hashRequest(request), since)
+	if err != nil {
+		return response, err
+	}
+	defer res.Close()
+	for res.Next() {
+		err = res.Scan(&response)
+		if err != nil {
+			return response, err
+		}
+		return response, nil
+	}
+	return response, ErrNotFound
+}
+
+// CreateFailedRequest keeps the last failure of the request
+func (storage *MySqlStorage) CreateFailedRequest(request models.FailedRequest) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	req, _ := db.Prepare(storage.upsertQuery("failed_requests", []string{"request_hash"},
+		"request", "kind", "status", "error", "attempts", "created_at"))
+	_, err = req.Exec(hashRequest(request.Request), request.Request, request.Kind, request.Status, request.Error,
+		request.Attempts, request.CreatedAt)
+	req.Close()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (storage *MySqlStorage) GetFailedRequests() ([]models.FailedRequest, error) {
+	var requests []models.FailedRequest
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return requests, err
+	}
+	res, err := db.Query(`SELECT request, kind, status, error, attempts, created_at FROM failed_requests ORDER BY created_at`)
+	if err != nil {
+		return requests, err
+	}
+	defer res.Close()
+	for res.Next() {
+		var request models.FailedRequest
+		err = res.Scan(&request.Request, &request.Kind, &request.Status, &request.Error, &request.Attempts,
+			&request.CreatedAt)
+		if err != nil {
+			return requests, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, res.Err()
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"net/url"
+)
+
+const createFinishedRequestsTablePostgres = `CREATE TABLE IF NOT EXISTS finished_requests(
+	request_hash VARCHAR(40),
+	request TEXT,
+	response TEXT,
+	created_at BIGINT,
+	PRIMARY KEY (request_hash)
+)`
+
+const createCrawlTasksTablePostgres = `CREATE TABLE IF NOT EXISTS crawl_tasks (
+	id BIGSERIAL PRIMARY KEY,
+	task_key VARCHAR(64) NOT NULL UNIQUE,
+	job_id VARCHAR(32),
+	source_name VARCHAR(32),
+	scopus_id VARCHAR(32),
+	fields TEXT,
+	bypass_cache BOOLEAN,
+	depth INTEGER,
+	state VARCHAR(16),
+	lease_owner VARCHAR(64),
+	lease_until BIGINT,
+	attempts INTEGER,
+	last_error TEXT,
+	created_at BIGINT
+)`
+
+func postgresDSN(storage *MySqlStorage) string {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(storage.User, storage.Password),
+		Host:   storage.Address,
+		Path:   "/" + storage.DbName,
+	}
+	sslMode := storage.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	dsn.RawQuery = url.Values{"sslmode": []string{sslMode}}.Encode()
+	return dsn.String()
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"encoding/json"
+
+	"../models"
+)
+
+const createJobSplitsTable = `CREATE TABLE IF NOT EXISTS job_splits (
+	job_id VARCHAR(32),
+	id VARCHAR(64),
+	parent_id VARCHAR(64),
+	fields TEXT,
+	total_results INTEGER,
+	split_by VARCHAR(16),
+	pages INTEGER,
+	truncated BOOLEAN,
+	created_at BIGINT,
+	PRIMARY KEY (job_id, id)
+)`
+
+// CreateJobSplit adds the split to its job, the existing ones are left as is
+func (storage *MySqlStorage) CreateJobSplit(split models.JobSplit) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	return storage.createJobSplit(db, split)
+}
+
+func (storage *MySqlStorage) createJobSplit(db execer, split models.JobSplit) error {
+	fields, err := json.Marshal(split.Fields)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.insertIgnoreQuery("job_splits", "job_id", "id", "parent_id", "fields", "total_results",
+		"split_by", "pages", "truncated", "created_at"), split.JobID, split.ID, split.ParentID, string(fields),
+		split.TotalResults, split.SplitBy, split.Pages, split.Truncated, split.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateJobSplit stores how the search of the split was planned
+func (storage *MySqlStorage) UpdateJobSplit(split models.JobSplit) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.rebind(`UPDATE job_splits SET total_results = ?, split_by = ?, pages = ?, truncated = ?
+		WHERE job_id = ? AND id = ?`), split.TotalResults, split.SplitBy, split.Pages, split.Truncated,
+		split.JobID, split.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetJobSplits returns the splits of the job in the order they were planned
+func (storage *MySqlStorage) GetJobSplits(jobID string) ([]models.JobSplit, error) {
+	var splits []models.JobSplit
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return splits, err
+	}
+	res, err := db.Query(storage.rebind(`SELECT job_id, id, parent_id, fields, total_results, split_by, pages,
+		truncated, created_at FROM job_splits WHERE job_id = ? ORDER BY created_at, id`), jobID)
+	if err != nil {
+		return splits, err
+	}
+	defer res.Close()
+	for res.Next() {
+		var split models.JobSplit
+		var fields string
+		err = res.Scan(&split.JobID, &split.ID, &split.ParentID, &fields, &split.TotalResults, &split.SplitBy,
+			&split.Pages, &split.Truncated, &split.CreatedAt)
+		if err != nil {
+			return splits, err
+		}
+		err = json.Unmarshal([]byte(fields), &split.Fields)
+		if err != nil {
+			return splits, err
+		}
+		splits = append(splits, split)
+	}
+	return splits, res.Err()
+}
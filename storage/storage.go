@@ -1,6 +1,15 @@
 package storage
 
-import "../models"
+import (
+	"errors"
+	"time"
+
+	"../config"
+	"../models"
+)
+
+// ErrNotFound is returned when the requested record is absent in the storage
+var ErrNotFound = errors.New("data was not found in the storage")
 
 // GenericStorage is a general interface for data storage
 type GenericStorage interface {
@@ -9,33 +18,93 @@ type GenericStorage interface {
 	CreateAuthor(author models.Author) error
 	UpdateAuthor(author models.Author) error
 	GetAuthor(scopusID string) (models.Author, error)
-	SearchAuthors(fields map[string]string) ([]models.Author, error)
+	SearchAuthors(filter Filter) ([]models.Author, error)
 	DeleteAuthor(scopusID string) error
+	CreateAuthorProfile(author models.Author) error
 
 	CreateAffiliation(affiliation models.Affiliation) error
 	UpdateAffiliation(affiliation models.Affiliation) error
 	GetAffiliation(scopusID string) (models.Affiliation, error)
-	SearchAffiliations(fields map[string]string) ([]models.Affiliation, error)
+	SearchAffiliations(filter Filter) ([]models.Affiliation, error)
 	DeleteAffiliation(scopusID string) error
+	CheckAffiliation(afid string) (bool, error)
 
 	CreateArticle(article models.Article) error
+	CreateArticles(articles []models.Article) error
 	UpdateArticle(article models.Article) error
-	GetArticle(scopusID string) (models.Article, error)
-	SearchArticles(fields map[string]string) ([]models.Article, error)
+	GetArticle(scopusID string, load LoadOptions) (models.Article, error)
+	GetArticles(scopusIDs []string, load LoadOptions) ([]models.Article, error)
+	SearchArticles(filter Filter) ([]models.Article, error)
 	DeleteArticle(scopusID string) error
+	CreateArticleReference(articleID string, referenceID string) error
 
 	CreateSubjectArea(area models.SubjectArea) error
 	UpdateSubjectArea(area models.SubjectArea) error
 	GetSubjectArea(scopusID string) (models.SubjectArea, error)
-	SearchSubjectAreas(fields map[string]string) ([]models.SubjectArea, error)
+	SearchSubjectAreas(filter Filter) ([]models.SubjectArea, error)
 	DeleteSubjectArea(scopusID string) error
 
 	CreateKeyword(keyword models.Keyword) error
 	UpdateKeyword(article models.Keyword) error
 	GetKeyword(id string) (models.Keyword, error)
-	SearchKeywords(fields map[string]string) ([]models.Keyword, error)
+	SearchKeywords(filter Filter) ([]models.Keyword, error)
 	DeleteKeyword(id string) error
 
 	CreateFinishedRequest(request string, response string) error
-	GetFinishedRequest(request string) (string, error)
+	GetFinishedRequest(request string, maxAge time.Duration) (string, error)
+
+	CreateFailedRequest(request models.FailedRequest) error
+	GetFailedRequests() ([]models.FailedRequest, error)
+
+	CreateJob(job models.Job) error
+	CreateJobWithTasks(job models.Job, splits []models.JobSplit, tasks []models.Task, visited []string) error
+	GetJob(id string) (models.Job, error)
+	UpdateJobState(id string, state string) error
+	StartJob(id string) error
+	UpdateJobProgress(id string, progress models.JobProgress) error
+
+	CreateJobSplit(split models.JobSplit) error
+	UpdateJobSplit(split models.JobSplit) error
+	GetJobSplits(jobID string) ([]models.JobSplit, error)
+
+	CreateTask(task models.Task) error
+	LeaseTask(owner string, lease time.Duration) (models.Task, error)
+	CompleteTask(id int64) error
+	FailTask(id int64, reason string) error
+	ReleaseTasks() error
+	CountActiveTasks(jobID string) (int, error)
+
+	CreateVisitedTask(task models.Task) (bool, error)
+}
+
+// MySqlStorage serves MySQL, SQLite and Postgres databases
+var _ GenericStorage = (*MySqlStorage)(nil)
+
+// NewStorage makes the storage set up in the configuration, it has to be
+// initialized before use
+func NewStorage(conf config.Configuration) (GenericStorage, error) {
+	dbType, err := ParseDatabaseType(conf.DatabaseType)
+	if err != nil {
+		return nil, err
+	}
+	if dbType == MEMORY {
+		return NewMemoryStorage(), nil
+	}
+	storage := MySqlStorage{
+		DBType:   dbType,
+		User:     conf.Mysqluser,
+		Password: conf.Mysqlpass,
+		Address:  conf.Mysqladdress,
+		DbName:   conf.Mysqldbname}
+	switch dbType {
+	case SQLITE:
+		storage.DbName = conf.SqlitePath
+	case POSTGRES:
+		storage.User = conf.Postgresuser
+		storage.Password = conf.Postgrespass
+		storage.Address = conf.Postgresaddress
+		storage.DbName = conf.Postgresdbname
+		storage.SSLMode = conf.Postgressslmode
+	}
+	return &storage, nil
 }
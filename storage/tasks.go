@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"../models"
+)
+
+const createCrawlTasksTable = `CREATE TABLE IF NOT EXISTS crawl_tasks (
+	id BIGINT NOT NULL AUTO_INCREMENT,
+	task_key VARCHAR(64) NOT NULL,
+	job_id VARCHAR(32),
+	source_name VARCHAR(32),
+	scopus_id VARCHAR(32),
+	fields TEXT,
+	bypass_cache BOOLEAN,
+	depth INTEGER,
+	state VARCHAR(16),
+	lease_owner VARCHAR(64),
+	lease_until BIGINT,
+	attempts INTEGER,
+	last_error TEXT,
+	created_at BIGINT,
+	PRIMARY KEY (id),
+	UNIQUE KEY (task_key),
+	KEY (state, id),
+	KEY (job_id, state)
+)`
+
+const createCrawlTasksTableSqlite = `CREATE TABLE IF NOT EXISTS crawl_tasks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_key VARCHAR(64) NOT NULL UNIQUE,
+	job_id VARCHAR(32),
+	source_name VARCHAR(32),
+	scopus_id VARCHAR(32),
+	fields TEXT,
+	bypass_cache BOOLEAN,
+	depth INTEGER,
+	state VARCHAR(16),
+	lease_owner VARCHAR(64),
+	lease_until BIGINT,
+	attempts INTEGER,
+	last_error TEXT,
+	created_at BIGINT
+)`
+
+const createCrawlTasksStateIndex = `CREATE INDEX IF NOT EXISTS crawl_tasks_state ON crawl_tasks (state, id)`
+
+const createCrawlTasksJobIndex = `CREATE INDEX IF NOT EXISTS crawl_tasks_job ON crawl_tasks (job_id, state)`
+
+func (storage *MySqlStorage) crawlTasksSchema() []string {
+	switch storage.DBType {
+	case SQLITE:
+		return []string{createCrawlTasksTableSqlite, createCrawlTasksStateIndex, createCrawlTasksJobIndex}
+	case POSTGRES:
+		return []string{createCrawlTasksTablePostgres, createCrawlTasksStateIndex, createCrawlTasksJobIndex}
+	}
+	return []string{createCrawlTasksTable}
+}
+
+// CreateTask puts the task into the queue. Tasks with a key that is already
+// known are ignored, so replaying a half-done task does not duplicate the work.
+func (storage *MySqlStorage) CreateTask(task models.Task) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	return storage.createTask(db, task)
+}
+
+func (storage *MySqlStorage) createTask(db execer, task models.Task) error {
+	fields, err := json.Marshal(task.Fields)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.insertIgnoreQuery("crawl_tasks", "task_key", "job_id", "source_name", "scopus_id",
+		"fields", "bypass_cache", "depth", "state", "lease_owner", "lease_until", "attempts", "last_error",
+		"created_at"), task.Key, task.JobID, task.SourceName, task.ScopusID, string(fields), task.BypassCache,
+		task.Depth, models.TaskPending, "", 0, 0, "", time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// LeaseTask hands the oldest available task to the owner for the lease duration.
+// Tasks whose lease has expired are available again. ErrNotFound is returned
+// when the queue is empty.
+func (storage *MySqlStorage) LeaseTask(owner string, lease time.Duration) (models.Task, error) {
+	var task models.Task
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return task, err
+	}
+	now := time.Now()
+	query := `UPDATE crawl_tasks SET state = ?, lease_owner = ?, lease_until = ?, attempts = attempts + 1
+		WHERE state = ? OR (state = ? AND lease_until < ?) ORDER BY id LIMIT 1`
+	switch storage.DBType {
+	case SQLITE:
+		// SQLite has no UPDATE ... LIMIT, the single writer makes the subquery safe
+		query = `UPDATE crawl_tasks SET state = ?, lease_owner = ?, lease_until = ?, attempts = attempts + 1
+			WHERE id = (SELECT id FROM crawl_tasks WHERE state = ? OR (state = ? AND lease_until < ?)
+			ORDER BY id LIMIT 1)`
+	case POSTGRES:
+		query = `UPDATE crawl_tasks SET state = ?, lease_owner = ?, lease_until = ?, attempts = attempts + 1
+			WHERE id = (SELECT id FROM crawl_tasks WHERE state = ? OR (state = ? AND lease_until < ?)
+			ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)`
+	}
+	_, err = db.Exec(storage.rebind(query),
+		models.TaskLeased, owner, now.Add(lease).Unix(), models.TaskPending, models.TaskLeased, now.Unix())
+	if err != nil {
+		return task, err
+	}
+	return storage.getLeasedTask(owner)
+}
+
+func (storage *MySqlStorage) getLeasedTask(owner string) (models.Task, error) {
+	var task models.Task
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return task, err
+	}
+	res, err := db.Query(storage.rebind(`SELECT id, task_key, job_id, source_name, scopus_id, fields, bypass_cache, depth, state,
+		attempts FROM crawl_tasks WHERE lease_owner = ? AND state = ? ORDER BY id DESC LIMIT 1`), owner, models.TaskLeased)
+	if err != nil {
+		return task, err
+	}
+	defer res.Close()
+	for res.Next() {
+		var fields string
+		err = res.Scan(&task.ID, &task.Key, &task.JobID, &task.SourceName, &task.ScopusID, &fields,
+			&task.BypassCache, &task.Depth, &task.State, &task.Attempts)
+		if err != nil {
+			return task, err
+		}
+		err = json.Unmarshal([]byte(fields), &task.Fields)
+		if err != nil {
+			return task, err
+		}
+		return task, nil
+	}
+	return task, ErrNotFound
+}
+
+func (storage *MySqlStorage) CompleteTask(id int64) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.rebind(`UPDATE crawl_tasks SET state = ?, lease_owner = '' WHERE id = ?`), models.TaskDone, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (storage *MySqlStorage) FailTask(id int64, reason string) error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.rebind(`UPDATE crawl_tasks SET state = ?, lease_owner = '', last_error = ? WHERE id = ?`),
+		models.TaskFailed, reason, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReleaseTasks returns all leased tasks to the queue. It is meant to be called
+// on startup, when the leases of the previous run can not be active anymore.
+func (storage *MySqlStorage) ReleaseTasks() error {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(storage.rebind(`UPDATE crawl_tasks SET state = ?, lease_owner = '' WHERE state = ?`),
+		models.TaskPending, models.TaskLeased)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CountActiveTasks returns the number of pending and leased tasks of the job
+func (storage *MySqlStorage) CountActiveTasks(jobID string) (int, error) {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Query(storage.rebind(`SELECT COUNT(*) FROM crawl_tasks WHERE job_id = ? AND state IN (?, ?)`),
+		jobID, models.TaskPending, models.TaskLeased)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	return checkCount(res)
+}
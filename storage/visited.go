@@ -0,0 +1,48 @@
+package storage
+
+import "../models"
+
+const createVisitedArticlesTable = `CREATE TABLE IF NOT EXISTS visited_articles (
+	job_id VARCHAR(32),
+	scopus_id VARCHAR(20),
+	PRIMARY KEY (job_id, scopus_id)
+)`
+
+// CreateVisitedTask queues the task of the article unless its job has
+// already visited the article. The article is marked visited in the same
+// transaction, so it is never marked without its task. It returns false if
+// the article was visited.
+func (storage *MySqlStorage) CreateVisitedTask(task models.Task) (bool, error) {
+	db, err := storage.getDBConnection()
+	if err != nil {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	added, err := storage.markVisited(tx, task.JobID, task.ScopusID)
+	if err != nil || !added {
+		return false, err
+	}
+	err = storage.createTask(tx, task)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// markVisited adds the article to the visited set of the job. It returns
+// false if the article was already there.
+func (storage *MySqlStorage) markVisited(db execer, jobID string, scopusID string) (bool, error) {
+	res, err := db.Exec(storage.insertIgnoreQuery("visited_articles", "job_id", "scopus_id"), jobID, scopusID)
+	if err != nil {
+		return false, err
+	}
+	added, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return added > 0, nil
+}